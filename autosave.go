@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// autosaveMsg fires when an autosave interval has elapsed.
+type autosaveMsg struct {
+	gen int
+}
+
+// restartAutosave schedules autosaves at a changed interval, or stops them
+// when it is zero. Ticks already scheduled for the previous interval are
+// ignored.
+func (m *model) restartAutosave() tea.Cmd {
+	m.autosaveGen++
+	return m.scheduleAutosave()
+}
+
+func (m model) scheduleAutosave() tea.Cmd {
+	if m.autosave == 0 {
+		return nil
+	}
+	gen := m.autosaveGen
+	return tea.Tick(time.Duration(m.autosave)*time.Second, func(time.Time) tea.Msg {
+		return autosaveMsg{gen: gen}
+	})
+}
+
+// handleAutosave writes a modified buffer that has a filename and isn't
+// read-only, then waits for the next interval.
+func (m model) handleAutosave(msg autosaveMsg) (tea.Model, tea.Cmd) {
+	if msg.gen != m.autosaveGen {
+		return m, nil
+	}
+	if m.modified && m.filename != "" && !m.readOnly {
+		gofmt := m.gofmt
+		m.gofmt = false // Leave the text alone while it is being typed
+		if m.saveFile() {
+			m.statusMsg = "Autosaved " + m.filename
+		}
+		m.gofmt = gofmt
+	}
+	return m, m.scheduleAutosave()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// buffer is a file open for editing. The model embeds the active one.
+type buffer struct {
+	content      [][]rune
+	cursorX      int
+	cursorY      int
+	offsetX      int
+	offsetY      int
+	filename     string
+	modified     bool
+	finalNewline bool            // Whether the file ends with a newline
+	marks        map[rune][2]int // Line and column of each mark
+	folds        []foldRange
+	jumps        [][2]int // Line and column before each jump, for Ctrl+O
+	jumpIndex    int      // Entry Ctrl+O goes back from, len(jumps) after a new jump
+	undoStack    []action
+	redoStack    []action
+	undoBase     *snapshot // Lines changed by the edit in progress, not yet on undoStack
+	swapWritten  bool      // Whether the swap file holds this session's changes
+	wroteFile    bool      // Whether the file has been written this session
+	modTime      time.Time // Modification time of the file when last read or written
+}
+
+// newBuffer returns a buffer holding filename, which starts out empty if it
+// can't be read. An empty filename gives an unnamed buffer.
+func newBuffer(filename string) buffer {
+	b := buffer{
+		content:      [][]rune{{}},
+		finalNewline: true,
+		filename:     filename,
+		marks:        make(map[rune][2]int),
+	}
+	if filename != "" {
+		b.loadFile(filename)
+	}
+	return b
+}
+
+// stdinFilename is the filename that stands for the standard input.
+const stdinFilename = "-"
+
+// readBuffer returns an unnamed buffer holding what r gives, for text piped
+// into the editor. It counts as modified, since it is nowhere on disk.
+func readBuffer(r io.Reader) (buffer, error) {
+	b := newBuffer("")
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return b, err
+	}
+	if len(data) > 0 {
+		b.content, b.finalNewline = splitLines(data)
+		b.modified = true
+	}
+	return b, nil
+}
+
+// openBuffer returns the index of the buffer holding filename, opening it in
+// a new buffer if needed.
+func (m *model) openBuffer(filename string) int {
+	for i, b := range m.buffers {
+		if i != m.bufferIndex && b.filename == filename {
+			return i
+		}
+	}
+	if filename == m.filename {
+		return m.bufferIndex
+	}
+	m.buffers = append(m.buffers, newBuffer(filename))
+	return len(m.buffers) - 1
+}
+
+// switchBuffer makes buffer i the active one, keeping the cursor and scroll
+// position of each.
+func (m *model) switchBuffer(i int) {
+	if i == m.bufferIndex {
+		return
+	}
+	// A buffer already on screen gets the focus instead of being shown twice
+	if m.split && i == m.splitBuffer {
+		m.splitBuffer = m.bufferIndex
+		m.splitBelow = !m.splitBelow
+	}
+	m.updateSwap()
+	m.buffers[m.bufferIndex] = m.buffer
+	m.bufferIndex = i
+	m.buffer = m.buffers[i]
+	m.layout()
+	m.statusMsg = fmt.Sprintf("Buffer %d: %s", i+1, bufferName(m.filename))
+	if !m.swapWritten {
+		m.offerRecovery()
+	}
+}
+
+// listBuffers describes the open buffers on a single line, marking the
+// active one with % and modified ones with [+].
+func (m model) listBuffers() string {
+	var list []string
+	for i, b := range m.buffers {
+		active := ""
+		if i == m.bufferIndex {
+			b, active = m.buffer, "%"
+		}
+		entry := fmt.Sprintf("%d%s %q", i+1, active, bufferName(b.filename))
+		if b.modified {
+			entry += " [+]"
+		}
+		list = append(list, entry)
+	}
+	return strings.Join(list, ", ")
+}
+
+// confirmQuit reports whether the editor may exit, which it may once no
+// buffer has unsaved changes or force is set.
+func (m *model) confirmQuit(force bool) bool {
+	if !m.confirmDiscard(force) {
+		return false
+	}
+	for i, b := range m.buffers {
+		if i != m.bufferIndex && b.modified && !force {
+			m.statusMsg = fmt.Sprintf("No write since last change for buffer %d (use ! to override)", i+1)
+			return false
+		}
+	}
+	return true
+}
+
+func bufferName(filename string) string {
+	if filename == "" {
+		return "[No Name]"
+	}
+	return filename
+}
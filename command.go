@@ -0,0 +1,594 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func (m model) handleCommandMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.mode = normalMode
+		m.statusMsg = "Normal mode"
+	case "enter":
+		m.mode = normalMode
+		m.statusMsg = "Normal mode"
+		cmd := m.executeCommand(m.commandBuffer)
+		return m, cmd
+	case "backspace":
+		if len(m.commandBuffer) == 0 {
+			m.mode = normalMode
+			m.statusMsg = "Normal mode"
+		} else {
+			runes := []rune(m.commandBuffer)
+			m.commandBuffer = string(runes[:len(runes)-1])
+			m.statusMsg = ":" + m.commandBuffer
+		}
+	default:
+		if len(msg.Runes) == 1 {
+			m.commandBuffer += string(msg.Runes[0])
+			m.statusMsg = ":" + m.commandBuffer
+		}
+	}
+	return m, nil
+}
+
+// executeCommand runs a command entered after ":" and returns the tea.Cmd it
+// produces, if any.
+func (m *model) executeCommand(input string) tea.Cmd {
+	// Commands taking a range work on the whole file unless they follow a
+	// visual selection.
+	startY, endY := 0, len(m.content)-1
+	if rest, ok := strings.CutPrefix(input, "'<,'>"); ok {
+		input = rest
+		startY = min(m.visualLines[0], endY)
+		endY = min(m.visualLines[1], endY)
+	}
+
+	if spec, ok := strings.CutPrefix(strings.TrimPrefix(input, "%"), "s/"); ok {
+		m.substitute(spec)
+		return nil
+	}
+	for _, prefix := range []string{"g/", "v/"} {
+		if spec, ok := strings.CutPrefix(strings.TrimPrefix(input, "%"), prefix); ok {
+			m.global(spec, startY, endY, prefix == "g/")
+			return nil
+		}
+	}
+
+	if command, ok := strings.CutPrefix(strings.TrimPrefix(input, "%"), "!"); ok {
+		m.filterLines(startY, endY, strings.TrimSpace(command))
+		return nil
+	}
+	if shell, ok := strings.CutPrefix(strings.TrimSpace(input), "r"); ok && strings.HasPrefix(strings.TrimSpace(shell), "!") {
+		m.readCommand(strings.TrimSpace(shell)[1:])
+		return nil
+	}
+
+	name, arg, _ := strings.Cut(strings.TrimSpace(input), " ")
+	arg = strings.TrimSpace(arg)
+	name, force := strings.CutSuffix(name, "!")
+
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		n, err := strconv.Atoi(name)
+		if err != nil {
+			m.statusMsg = "Invalid line number: " + name
+		} else {
+			m.goToLine(n)
+		}
+		return nil
+	}
+
+	switch name {
+	case "":
+		return nil
+	case "w":
+		if m.confirmWrite(force) {
+			m.write(arg)
+		}
+	case "e":
+		m.edit(arg, force)
+	case "q":
+		if m.confirmQuit(force) {
+			return tea.Sequence(tea.ClearScreen, tea.Quit)
+		}
+	case "wq":
+		if m.writeAndQuit(arg, force) {
+			return tea.Sequence(tea.ClearScreen, tea.Quit)
+		}
+	case "x", "xit":
+		if m.writeChangesAndQuit(arg, force) {
+			return tea.Sequence(tea.ClearScreen, tea.Quit)
+		}
+	case "bn", "bnext":
+		m.switchBuffer((m.bufferIndex + 1) % len(m.buffers))
+	case "bp", "bprevious":
+		m.switchBuffer((m.bufferIndex + len(m.buffers) - 1) % len(m.buffers))
+	case "b", "buffer":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(m.buffers) {
+			m.statusMsg = "No such buffer: " + arg
+		} else {
+			m.switchBuffer(n - 1)
+		}
+	case "sp", "split":
+		if arg != "" {
+			m.splitWindow(m.openBuffer(arg))
+		} else if len(m.buffers) > 1 {
+			m.splitWindow((m.bufferIndex + 1) % len(m.buffers))
+		} else {
+			m.statusMsg = "No other buffer to show (use :split <filename>)"
+		}
+	case "on", "only":
+		m.closeSplit()
+	case "ls", "buffers":
+		m.statusMsg = m.listBuffers()
+	case "find":
+		m.openFinder(arg)
+	case "matches":
+		m.listMatches()
+	case "noh", "nohlsearch":
+		m.noHighlight = true
+	case "strip":
+		m.stripTrailingWhitespace()
+	case "r", "read":
+		m.readFile(arg)
+	case "date":
+		m.insertDate()
+	case "wc":
+		m.showWordCount(startY, endY)
+	case "sort":
+		m.sortLines(startY, endY, arg, force)
+	case "retab":
+		m.retab(startY, endY, force)
+	case "set":
+		return m.setOption(arg)
+	default:
+		m.statusMsg = "Not an editor command: " + input
+	}
+	return nil
+}
+
+// substitute starts an interactive replace for ":s/pattern/replacement/",
+// asking for the replacement when it is left out.
+func (m *model) substitute(spec string) {
+	if m.readOnly {
+		m.refuseEdit()
+		return
+	}
+	parts := strings.SplitN(spec, "/", 3)
+	if parts[0] != "" {
+		m.searchTerm = parts[0]
+	}
+	if len(parts) < 2 {
+		m.mode = replaceMode
+		m.replaceTerm = ""
+		m.statusMsg = "Replace with: "
+		return
+	}
+	m.replaceTerm = parts[1]
+	m.startReplace()
+}
+
+// global runs ":g/pattern/d" on lines startY to endY, deleting the lines
+// matching the pattern, or the ones not matching it for ":v". The pattern
+// becomes the search term.
+func (m *model) global(spec string, startY, endY int, matching bool) {
+	if m.readOnly {
+		m.refuseEdit()
+		return
+	}
+	i := strings.LastIndex(spec, "/")
+	if i < 0 || spec[i+1:] != "d" {
+		m.statusMsg = "Only :g/pattern/d and :v/pattern/d are supported"
+		return
+	}
+	if i > 0 {
+		m.searchTerm = spec[:i]
+	}
+	re, ok := m.searchPattern()
+	if !ok {
+		return
+	}
+
+	var deleted []int
+	for y := startY; y <= endY; y++ {
+		if re.MatchString(string(m.content[y])) == matching {
+			deleted = append(deleted, y)
+		}
+	}
+	if len(deleted) == 0 {
+		m.statusMsg = "Pattern not found: " + m.searchTerm
+		return
+	}
+
+	m.saveAction() // Save current state for undo
+	m.changeLines(deleted[0], deleted[len(deleted)-1]+1)
+	kept := m.content[:deleted[0]]
+	for y := deleted[0]; y < len(m.content); y++ {
+		if _, found := slices.BinarySearch(deleted, y); !found {
+			kept = append(kept, m.content[y])
+		}
+	}
+	m.content = kept
+	for i := len(deleted) - 1; i >= 0; i-- {
+		m.shiftLineRefs(deleted[i], -1)
+	}
+	if len(m.content) == 0 {
+		m.content = [][]rune{{}}
+	}
+	m.cursorY = min(startY, len(m.content)-1)
+	m.cursorX = firstNonBlank(m.content[m.cursorY])
+	m.modified = true
+	m.adjustOffset()
+	m.statusMsg = fmt.Sprintf("%d fewer lines", len(deleted))
+}
+
+// write saves the buffer for ":w [file]". An unnamed buffer takes on the
+// name it is first written to.
+func (m *model) write(filename string) bool {
+	if filename == "" {
+		return m.saveFile()
+	}
+	if m.filename == "" {
+		m.filename = filename
+	}
+	if !m.writeFile(filename) {
+		return false
+	}
+	m.statusMsg = "File saved as " + resolvePath(filename)
+	return true
+}
+
+// readFile inserts the lines of filename below the cursor line for :r.
+func (m *model) readFile(filename string) {
+	if m.readOnly {
+		m.refuseEdit()
+		return
+	}
+	if filename == "" {
+		m.statusMsg = "No file name"
+		return
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		m.statusMsg = "Can't open file " + filename + ": " + err.Error()
+		return
+	}
+	m.insertBelow(string(data))
+	m.statusMsg = fmt.Sprintf("%q %d lines", filename, strings.Count(strings.TrimSuffix(string(data), "\n"), "\n")+1)
+}
+
+// readCommand runs command in the shell for :r! and inserts what it prints
+// below the cursor line. A command that fails inserts nothing.
+func (m *model) readCommand(command string) {
+	if m.readOnly {
+		m.refuseEdit()
+		return
+	}
+	if command == "" {
+		m.statusMsg = "Argument required"
+		return
+	}
+	out, ok := m.runShell(command, "")
+	if !ok {
+		return
+	}
+	m.insertBelow(out)
+	m.statusMsg = "!" + command
+}
+
+// filterLines pipes the lines from startY to endY through command for :!,
+// replacing them with what it prints as one undo action. A command that
+// fails leaves the buffer as it is.
+func (m *model) filterLines(startY, endY int, command string) {
+	if m.readOnly {
+		m.refuseEdit()
+		return
+	}
+	if command == "" {
+		m.statusMsg = "Argument required"
+		return
+	}
+	var input strings.Builder
+	for _, line := range m.content[startY : endY+1] {
+		input.WriteString(string(line) + "\n")
+	}
+	out, ok := m.runShell(command, input.String())
+	if !ok {
+		return
+	}
+
+	var lines [][]rune
+	if out != "" {
+		lines, _ = splitLines([]byte(out))
+	}
+	m.saveAction() // Save current state for undo
+	m.changeLines(startY, endY+1)
+	m.content = slices.Replace(m.content, startY, endY+1, lines...)
+	if added := len(lines) - (endY + 1 - startY); added > 0 {
+		m.shiftLineRefs(endY+1, added)
+	} else if added < 0 {
+		m.shiftLineRefs(startY+len(lines), added)
+	}
+	if len(m.content) == 0 {
+		m.content = [][]rune{{}}
+	}
+	m.cursorY = min(startY, len(m.content)-1)
+	m.cursorX = firstNonBlank(m.content[m.cursorY])
+	m.modified = true
+	m.adjustOffset()
+	m.statusMsg = fmt.Sprintf("%d lines filtered through !%s", endY+1-startY, command)
+}
+
+// runShell runs command in the shell with input on its standard input and
+// returns what it prints. When it fails, the error it printed goes to the
+// status bar.
+func (m *model) runShell(command, input string) (string, bool) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		msg := err.Error()
+		if exit, ok := err.(*exec.ExitError); ok && len(exit.Stderr) > 0 {
+			msg = strings.TrimSpace(string(exit.Stderr))
+		}
+		m.statusMsg = "Command failed: " + msg
+		return "", false
+	}
+	return string(out), true
+}
+
+// insertBelow adds the lines of text below the cursor line as one undo
+// action. Empty text adds nothing.
+func (m *model) insertBelow(text string) {
+	if text == "" {
+		return
+	}
+	m.saveAction() // Save current state for undo
+	m.pasteLines(min(m.cursorY+1, len(m.content)), text, 1)
+	m.adjustOffset()
+}
+
+// insertDate inserts the current date and time at the cursor for :date.
+func (m *model) insertDate() {
+	if m.readOnly {
+		m.refuseEdit()
+		return
+	}
+	m.saveAction() // Save current state for undo
+	m.pasteChars(time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// stripTrailingWhitespace removes the spaces and tabs ending each line as a
+// single undo action.
+func (m *model) stripTrailingWhitespace() {
+	if m.readOnly {
+		m.refuseEdit()
+		return
+	}
+	trimmed := func(line []rune) []rune {
+		end := len(line)
+		for end > 0 && (line[end-1] == ' ' || line[end-1] == '\t') {
+			end--
+		}
+		return line[:end]
+	}
+
+	count := 0
+	for _, line := range m.content {
+		if len(trimmed(line)) < len(line) {
+			count++
+		}
+	}
+	if count == 0 {
+		m.statusMsg = "No trailing whitespace"
+		return
+	}
+
+	m.saveAction() // Save current state for undo
+	for y, line := range m.content {
+		if t := trimmed(line); len(t) < len(line) {
+			m.changeLines(y, y+1)
+			m.content[y] = t
+		}
+	}
+	m.cursorX = min(m.cursorX, len(m.content[m.cursorY]))
+	m.modified = true
+	m.statusMsg = fmt.Sprintf("Stripped trailing whitespace from %d lines", count)
+}
+
+// sortLines sorts lines startY to endY as a single undo action, comparing
+// the first number on each line when opts is "n". Equal lines keep their
+// order, also when reverse sorts them from last to first.
+func (m *model) sortLines(startY, endY int, opts string, reverse bool) {
+	if m.readOnly {
+		m.refuseEdit()
+		return
+	}
+	var compare func(a, b []rune) int
+	switch opts {
+	case "":
+		compare = slices.Compare[[]rune]
+	case "n":
+		// Lines without a number sort before all others
+		compare = func(a, b []rune) int {
+			x, xok := firstNumber(a)
+			y, yok := firstNumber(b)
+			if xok != yok {
+				if xok {
+					return 1
+				}
+				return -1
+			}
+			return cmp.Compare(x, y)
+		}
+	default:
+		m.statusMsg = "Invalid sort option: " + opts
+		return
+	}
+
+	lines := slices.Clone(m.content[startY : endY+1])
+	slices.SortStableFunc(lines, func(a, b []rune) int {
+		if reverse {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+	if equalContent(lines, m.content[startY:endY+1]) {
+		m.statusMsg = "Lines already sorted"
+		return
+	}
+
+	m.saveAction() // Save current state for undo
+	m.changeLines(startY, endY+1)
+	copy(m.content[startY:], lines)
+	m.folds = nil // The sorted lines no longer match them
+	m.cursorY = startY
+	m.cursorX = firstNonBlank(m.content[startY])
+	m.modified = true
+	m.adjustOffset()
+	m.statusMsg = fmt.Sprintf("Sorted %d lines", len(lines))
+}
+
+// retab rewrites the indentation of lines startY to endY with spaces, or
+// with as many tabs as fit followed by spaces when toTabs is set, as a single
+// undo action. Tabs after the indentation are left alone.
+func (m *model) retab(startY, endY int, toTabs bool) {
+	if m.readOnly {
+		m.refuseEdit()
+		return
+	}
+	indent := func(width int) []rune {
+		if !toTabs {
+			return []rune(strings.Repeat(" ", width))
+		}
+		return []rune(strings.Repeat("\t", width/m.tabSize) + strings.Repeat(" ", width%m.tabSize))
+	}
+
+	changed := 0
+	for y := startY; y <= endY; y++ {
+		line := m.content[y]
+		end := firstNonBlank(line)
+		retabbed := indent(displayColumn(line, end, m.tabSize))
+		if slices.Equal(retabbed, line[:end]) {
+			continue
+		}
+		if changed == 0 {
+			m.saveAction() // Save current state for undo
+		}
+		m.changeLines(y, y+1)
+		m.content[y] = append(retabbed, line[end:]...)
+		changed++
+	}
+	if changed == 0 {
+		m.statusMsg = "No indentation to retab"
+		return
+	}
+	m.cursorX = min(m.cursorX, len(m.content[m.cursorY]))
+	m.modified = true
+	m.adjustOffset()
+	m.statusMsg = fmt.Sprintf("Retabbed %d lines", changed)
+}
+
+// confirmWrite reports whether the buffer may be written, which a read-only
+// one only may when force is set.
+func (m *model) confirmWrite(force bool) bool {
+	if m.readOnly && !force {
+		m.statusMsg = "E45: 'readonly' option is set (add ! to override)"
+		return false
+	}
+	return true
+}
+
+// writeAndQuit saves the buffer, to filename when it is given, and reports
+// whether the editor may quit. A failed write keeps it open, and a buffer
+// without a name is saved from a prompt that quits afterwards.
+func (m *model) writeAndQuit(filename string, force bool) bool {
+	if !m.confirmWrite(force) {
+		return false
+	}
+	if filename == "" && m.filename == "" {
+		m.promptSaveAs(tea.Sequence(tea.ClearScreen, tea.Quit))
+		return false
+	}
+	return m.write(filename) && m.confirmQuit(force)
+}
+
+// writeChangesAndQuit is writeAndQuit for :x and ZZ, which leave a buffer
+// without changes as it is on disk.
+func (m *model) writeChangesAndQuit(filename string, force bool) bool {
+	if !m.modified && filename == "" {
+		return m.confirmQuit(force)
+	}
+	return m.writeAndQuit(filename, force)
+}
+
+// confirmDiscard reports whether unsaved changes may be thrown away, which
+// force allows. Otherwise it tells the user how to override.
+func (m *model) confirmDiscard(force bool) bool {
+	if m.modified && !force {
+		m.statusMsg = "No write since last change (use ! to override)"
+		return false
+	}
+	return true
+}
+
+// promptSaveAs asks for a filename for an unnamed buffer, writes to it, and
+// then returns then.
+func (m *model) promptSaveAs(then tea.Cmd) {
+	m.prompt("Save as: ", func(m *model, filename string) tea.Cmd {
+		if filename == "" {
+			m.statusMsg = "No file name"
+			return nil
+		}
+		if !m.write(filename) {
+			return nil
+		}
+		return then
+	})
+}
+
+// prompt reads a line of input in the status bar and passes it to action
+// when Enter is pressed.
+func (m *model) prompt(label string, action func(m *model, input string) tea.Cmd) {
+	m.mode = promptMode
+	m.promptLabel = label
+	m.promptInput = ""
+	m.promptAction = action
+	m.statusMsg = label
+}
+
+func (m model) handlePromptMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.mode = normalMode
+		m.statusMsg = "Normal mode"
+	case "enter":
+		m.mode = normalMode
+		m.statusMsg = "Normal mode"
+		cmd := m.promptAction(&m, strings.TrimSpace(m.promptInput))
+		return m, cmd
+	case "backspace":
+		if len(m.promptInput) > 0 {
+			runes := []rune(m.promptInput)
+			m.promptInput = string(runes[:len(runes)-1])
+			m.statusMsg = m.promptLabel + m.promptInput
+		}
+	default:
+		if len(msg.Runes) == 1 {
+			m.promptInput += string(msg.Runes[0])
+			m.statusMsg = m.promptLabel + m.promptInput
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGoToLine(t *testing.T) {
+	tests := []struct {
+		command string
+		want    int
+	}{
+		{":2", 1},
+		{":99", 2},
+		{":0", 0},
+	}
+	for _, tt := range tests {
+		m := press(newTestModel("one\ntwo\nthree"), "j", "j")
+		m = press(m, strings.Split(tt.command, "")...)
+		m = press(m, "enter")
+		if m.cursorY != tt.want {
+			t.Errorf("%s: cursor on line %d, want %d", tt.command, m.cursorY, tt.want)
+		}
+	}
+}
+
+func TestGoToLineRejectsText(t *testing.T) {
+	m := press(newTestModel("one\ntwo"), ":", "2", "x", "enter")
+	if m.cursorY != 0 || m.statusMsg != "Invalid line number: 2x" {
+		t.Errorf("cursor on line %d with %q, want line 0 with an error", m.cursorY, m.statusMsg)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// commentPrefixes holds the line comment marker of each file extension.
+var commentPrefixes = map[string]string{
+	".go":   "//",
+	".c":    "//",
+	".h":    "//",
+	".js":   "//",
+	".ts":   "//",
+	".rs":   "//",
+	".java": "//",
+	".sh":   "#",
+	".py":   "#",
+	".rb":   "#",
+	".yaml": "#",
+	".yml":  "#",
+	".toml": "#",
+}
+
+// toggleComment comments out the lines startY to endY, or uncomments them if
+// the first one is commented, as a single undo action. The marker goes after
+// each line's indentation and blank lines are left alone.
+func (m *model) toggleComment(startY, endY int) {
+	prefix, ok := commentPrefixes[filepath.Ext(m.filename)]
+	if !ok {
+		m.statusMsg = "No comment style for this file type"
+		return
+	}
+	first := m.content[startY]
+	uncomment := strings.HasPrefix(string(first[firstNonBlank(first):]), prefix)
+
+	m.saveAction() // Save current state for undo
+	m.changeLines(startY, endY+1)
+	marker := []rune(prefix + " ")
+	for y := startY; y <= endY; y++ {
+		line := m.content[y]
+		indent := firstNonBlank(line)
+		text := string(line[indent:])
+		switch {
+		case text == "":
+		case uncomment:
+			if rest, ok := strings.CutPrefix(text, prefix); ok {
+				rest = strings.TrimPrefix(rest, " ")
+				m.content[y] = append(line[:indent:indent], []rune(rest)...)
+			}
+		default:
+			m.content[y] = slices.Insert(line, indent, marker...)
+		}
+	}
+	m.cursorY = startY
+	m.cursorX = firstNonBlank(m.content[startY])
+	m.modified = true
+	m.adjustOffset()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+)
+
+// complete replaces the word before the cursor with the next completion
+// from the words in the buffer for Ctrl+N, or the previous one for Ctrl+P.
+// The first press collects the words starting with the part already typed,
+// nearest after the cursor first; cycling past either end brings back what
+// was typed.
+func (m *model) complete(forward bool) {
+	line := m.content[m.cursorY]
+	if m.completions == nil {
+		start := m.cursorX
+		for start > 0 && isWordChar(line[start-1]) {
+			start--
+		}
+		words := m.wordsWithPrefix(line[start:m.cursorX], start)
+		if len(words) == 0 {
+			m.statusMsg = "Pattern not found"
+			return
+		}
+		m.completions = append([]string{string(line[start:m.cursorX])}, words...)
+		m.completionIndex = 0
+		m.completionStart = start
+	}
+
+	n := len(m.completions)
+	if forward {
+		m.completionIndex = (m.completionIndex + 1) % n
+	} else {
+		m.completionIndex = (m.completionIndex + n - 1) % n
+	}
+	word := []rune(m.completions[m.completionIndex])
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = slices.Concat(line[:m.completionStart], word, line[m.cursorX:])
+	m.cursorX = m.completionStart + len(word)
+	m.modified = true
+	if m.completionIndex == 0 {
+		m.statusMsg = "Back at original"
+	} else {
+		m.statusMsg = "match " + strconv.Itoa(m.completionIndex) + " of " + strconv.Itoa(n-1)
+	}
+}
+
+// wordsWithPrefix returns the words in the buffer that start with prefix and
+// are longer, once each, in the order they come in going down from the
+// cursor and around from the top. The word being typed, starting at column
+// start of the cursor line, is left out.
+func (m model) wordsWithPrefix(prefix []rune, start int) []string {
+	var words []string
+	seen := make(map[string]bool)
+	// The cursor line comes first from the cursor on, and last up to it
+	for i := range len(m.content) + 1 {
+		y := (m.cursorY + i) % len(m.content)
+		line := m.content[y]
+		from, to := 0, len(line)
+		if i == 0 {
+			from = min(m.cursorX, len(line))
+			for from < len(line) && isWordChar(line[from]) {
+				from++ // Rest of the word being typed
+			}
+		} else if i == len(m.content) {
+			to = start
+		}
+		for x := from; x < to; {
+			if !isWordChar(line[x]) {
+				x++
+				continue
+			}
+			end := x
+			for end < len(line) && isWordChar(line[end]) {
+				end++
+			}
+			word := line[x:end]
+			if len(word) > len(prefix) && slices.Equal(word[:len(prefix)], prefix) && !seen[string(word)] {
+				seen[string(word)] = true
+				words = append(words, string(word))
+			}
+			x = end
+		}
+	}
+	return words
+}
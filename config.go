@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configFile is the name of the file in the home directory holding settings
+// to apply at startup.
+const configFile = ".goeditorrc"
+
+// configPath returns where the settings file is, or "" without a home
+// directory.
+func configPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, configFile)
+}
+
+// loadConfig applies the ":set" arguments in the file at path, one per line
+// with or without a leading "set". Blank lines and lines starting with " or #
+// are skipped. Problems are collected into the status message rather than
+// stopping the editor from starting; a missing file is not one.
+func (m *model) loadConfig(path string) {
+	if path == "" {
+		return
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	var warnings []string
+	if err != nil {
+		warnings = append(warnings, "Error reading "+path+": "+err.Error())
+	} else {
+		defer f.Close()
+		status := m.statusMsg
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || line[0] == '"' || line[0] == '#' {
+				continue
+			}
+			line = strings.TrimPrefix(line, ":")
+			if rest, ok := strings.CutPrefix(line, "set "); ok {
+				line = strings.TrimSpace(rest)
+			}
+			m.statusMsg = ""
+			m.setOption(line)
+			if m.statusMsg != "" {
+				warnings = append(warnings, fmt.Sprintf("%s:%d: %s", configFile, n, m.statusMsg))
+			}
+		}
+		m.statusMsg = status
+	}
+	// A pending prompt keeps its question on screen
+	if len(warnings) > 0 && m.mode != promptMode {
+		m.statusMsg = strings.Join(warnings, "; ")
+	}
+}
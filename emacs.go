@@ -0,0 +1,210 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Key bindings the keymap setting chooses between.
+const (
+	vimKeymap   = "vim"
+	emacsKeymap = "emacs"
+)
+
+var keymaps = []string{vimKeymap, emacsKeymap}
+
+// emacsEditKeys are the emacs bindings that change the buffer, refused when
+// it is read-only. Typed text is refused as well.
+var emacsEditKeys = map[string]bool{
+	"enter": true, "backspace": true, "tab": true, "ctrl+d": true, "delete": true,
+	"ctrl+k": true, "ctrl+y": true, "ctrl+_": true, "ctrl+/": true,
+}
+
+// applyKeymap puts the editor in the state the keymap edits in: the emacs
+// keymap always inserts typed text, the vim one starts in normal mode.
+func (m *model) applyKeymap() tea.Cmd {
+	switch {
+	case m.keymap == emacsKeymap && m.mode == normalMode:
+		m.mode = insertMode
+		m.statusMsg = "Emacs keymap"
+	case m.keymap == vimKeymap && m.mode == insertMode:
+		m.endTyping()
+		m.mode = normalMode
+		m.statusMsg = "Normal mode"
+	}
+	return nil
+}
+
+// endTyping closes the undo action of the text typed since the last emacs
+// command, so each run of typing undoes on its own.
+func (m *model) endTyping() {
+	if m.editChanged() {
+		m.redoStack = nil
+		m.changeTick++
+	}
+	m.flushUndo()
+}
+
+// handleEmacsKey handles a key with the emacs keymap. Typed text goes into
+// the buffer like in insert mode, and commands are bound to Ctrl and Alt
+// keys. Alt+x opens the command line for everything else.
+func (m model) handleEmacsKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	typing := m.pendingOp == "" && (key == "enter" || key == "backspace" || key == "tab" || msg.Type == tea.KeyRunes && !msg.Alt)
+	if m.readOnly && (typing || m.pendingOp == "" && emacsEditKeys[key]) {
+		m.refuseEdit()
+		return m, nil
+	}
+	m.mode = insertMode // Back from the command line or a search
+	if typing {
+		if m.undoBase == nil {
+			m.beginUndo()
+		}
+		return m.handleInsertMode(msg)
+	}
+	m.endTyping()
+	killed := m.killed
+	m.killed = false
+	if m.pendingOp == "ctrl+x" {
+		m.pendingOp = ""
+		return m.handleEmacsPrefix(key)
+	}
+
+	switch key {
+	case "ctrl+f", "right":
+		m.cursorX = min(m.cursorX+1, len(m.content[m.cursorY]))
+	case "ctrl+b", "left":
+		m.cursorX = max(m.cursorX-1, 0)
+	case "ctrl+n", "down":
+		m.moveCursor(0, 1)
+	case "ctrl+p", "up":
+		m.moveCursor(0, -1)
+	case "ctrl+a", "home":
+		m.cursorX = 0
+	case "ctrl+e", "end":
+		m.cursorX = len(m.content[m.cursorY])
+	case "alt+f":
+		m.wordForward()
+	case "alt+b":
+		m.wordBackward()
+	case "alt+<":
+		m.pushJump()
+		m.cursorY, m.cursorX = 0, 0
+	case "alt+>":
+		m.pushJump()
+		m.cursorY = len(m.content) - 1
+		m.cursorX = len(m.content[m.cursorY])
+	case "ctrl+v", "pgdown":
+		m.moveCursor(0, m.height)
+	case "alt+v", "pgup":
+		m.moveCursor(0, -m.height)
+	case "ctrl+d", "delete":
+		m.deleteForward()
+	case "ctrl+k":
+		m.killLine(killed)
+		m.killed = true
+	case "ctrl+y":
+		m.yankBack()
+	case "ctrl+_", "ctrl+/":
+		m.undo()
+	case "ctrl+s":
+		if m.confirmWrite(false) {
+			m.saveFile()
+		}
+	case "ctrl+r":
+		m.startSearch()
+	case "alt+x":
+		m.mode = commandMode
+		m.commandBuffer = ""
+		m.statusMsg = ":"
+	case "ctrl+g":
+		m.statusMsg = "Quit"
+	case "ctrl+x":
+		m.pendingOp = "ctrl+x"
+		m.statusMsg = "C-x-"
+	case "ctrl+c":
+		return m, tea.Sequence(tea.ClearScreen, tea.Quit)
+	}
+	m.adjustOffset()
+	return m, nil
+}
+
+// handleEmacsPrefix handles the key typed after Ctrl+X.
+func (m model) handleEmacsPrefix(key string) (tea.Model, tea.Cmd) {
+	switch key {
+	case "ctrl+s":
+		if m.confirmWrite(false) {
+			m.saveFile()
+		}
+	case "ctrl+c":
+		if m.confirmQuit(false) {
+			return m, tea.Sequence(tea.ClearScreen, tea.Quit)
+		}
+	case "u":
+		m.undo()
+	case "o":
+		if m.split {
+			m.switchBuffer(m.splitBuffer)
+		}
+	default:
+		m.statusMsg = "C-x " + key + " is undefined"
+	}
+	m.adjustOffset()
+	return m, nil
+}
+
+// deleteForward removes the rune under the cursor, joining the next line on
+// at the end of a line.
+func (m *model) deleteForward() {
+	line := m.content[m.cursorY]
+	if m.cursorX < len(line) {
+		m.deleteChars(1)
+		return
+	}
+	if m.cursorY+1 < len(m.content) {
+		m.saveAction() // Save current state for undo
+		m.changeLines(m.cursorY, m.cursorY+2)
+		m.content[m.cursorY] = append(line, m.content[m.cursorY+1]...)
+		m.content = append(m.content[:m.cursorY+1], m.content[m.cursorY+2:]...)
+		m.shiftLineRefs(m.cursorY+1, -1)
+		m.modified = true
+	}
+}
+
+// killLine removes the text from the cursor to the end of the line into
+// the clipboard, or the line break when the cursor is at the end already.
+// Right after another kill, the text is added to what that one removed.
+func (m *model) killLine(appendKill bool) {
+	prev := m.clipboard
+	if m.cursorX < len(m.content[m.cursorY]) {
+		m.deleteToEnd()
+	} else if m.cursorY+1 < len(m.content) {
+		m.yankText("\n", false)
+		m.deleteForward()
+	} else {
+		return
+	}
+	if appendKill {
+		m.clipboard = prev + m.clipboard
+	}
+}
+
+// yankBack inserts the clipboard at the cursor, leaving the cursor after
+// the inserted text.
+func (m *model) yankBack() {
+	text, _ := m.registerText()
+	if text == "" {
+		return
+	}
+	m.saveAction() // Save current state for undo
+	y, x := m.cursorY, min(m.cursorX, len(m.content[m.cursorY]))
+	m.pasteChars(text)
+	pieces := strings.Split(text, "\n")
+	last := []rune(pieces[len(pieces)-1])
+	m.cursorY = y + len(pieces) - 1
+	m.cursorX = len(last)
+	if len(pieces) == 1 {
+		m.cursorX += x
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tickInterval is how often background checks on the file run.
+const tickInterval = 4 * time.Second
+
+// tickMsg fires every tickInterval to keep the swap file up to date and to
+// notice changes made to the file by other programs.
+type tickMsg struct{}
+
+func scheduleTick() tea.Cmd {
+	return tea.Tick(tickInterval, func(time.Time) tea.Msg {
+		return tickMsg{}
+	})
+}
+
+// loadFile replaces the buffer with the contents of filename. The cursor
+// stays where it was as far as the new content allows.
+func (m *buffer) loadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	m.content, m.finalNewline = splitLines(data)
+	m.filename = filename
+	m.modified = false
+	m.wroteFile = false
+	m.undoStack = nil
+	m.redoStack = nil
+	m.undoBase = nil
+	m.folds = nil
+	m.cursorY = min(m.cursorY, len(m.content)-1)
+	m.cursorX = min(m.cursorX, len(m.content[m.cursorY]))
+	m.noteModTime()
+	return nil
+}
+
+// edit opens filename in place of the buffer, or reloads the buffer's own
+// file when filename is empty. Unsaved changes are only dropped with force.
+func (m *model) edit(filename string, force bool) {
+	if filename == "" {
+		filename = m.filename
+	}
+	if filename == "" {
+		m.statusMsg = "No file name"
+		return
+	}
+	if !m.confirmDiscard(force) {
+		return
+	}
+
+	reload := filename == m.filename
+	m.removeSwap()
+	if err := m.loadFile(filename); err != nil {
+		m.statusMsg = "Error opening file: " + err.Error()
+		return
+	}
+	m.statusMsg = "Reloaded " + filename
+	if !reload {
+		m.cursorX, m.cursorY = 0, 0
+		m.offsetX, m.offsetY = 0, 0
+		m.marks = make(map[rune][2]int)
+		m.statusMsg = "Opened " + filename
+		m.offerRecovery()
+	}
+	m.adjustOffset()
+}
+
+// noteModTime remembers when the file was last changed, so later changes by
+// other programs can be told apart.
+func (m *buffer) noteModTime() {
+	if info, err := os.Stat(m.filename); err == nil {
+		m.modTime = info.ModTime()
+	}
+}
+
+// checkDisk looks for changes made to the file by other programs. An
+// unmodified buffer is reloaded; otherwise the user is warned once.
+func (m *model) checkDisk() {
+	if m.filename == "" || m.modTime.IsZero() || m.mode != normalMode {
+		return
+	}
+	info, err := os.Stat(m.filename)
+	if err != nil || info.ModTime().Equal(m.modTime) {
+		return
+	}
+	m.modTime = info.ModTime()
+	if m.modified {
+		m.statusMsg = "File changed on disk (use :e! to reload and discard changes)"
+		return
+	}
+	if err := m.loadFile(m.filename); err != nil {
+		m.statusMsg = "Error reloading file: " + err.Error()
+		return
+	}
+	m.adjustOffset()
+	m.statusMsg = "File changed on disk, reloaded"
+}
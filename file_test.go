@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSaveUnmodifiedFileKeepsBytes(t *testing.T) {
+	data := "package main\n\n\tfunc héllo() {}\r\n\n// 世界 without a final newline"
+	path := filepath.Join(t.TempDir(), "file.go")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := initialModel(path)
+	if !m.saveFile() {
+		t.Fatalf("save failed: %s", m.statusMsg)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("saved %q, want %q", got, data)
+	}
+}
+
+func TestLoadAndSaveLineEndings(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		lines []string
+	}{
+		{"empty file", "", []string{""}},
+		{"only a newline", "\n", []string{""}},
+		{"no final newline", "a", []string{"a"}},
+		{"final newline", "a\n", []string{"a"}},
+		{"blank last line", "a\n\n", []string{"a", ""}},
+		{"two lines without a final newline", "a\nb", []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "file.txt")
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m := initialModel(path)
+		var lines []string
+		for _, line := range m.content {
+			lines = append(lines, string(line))
+		}
+		if !slices.Equal(lines, tt.lines) {
+			t.Errorf("%s: loaded %q, want %q", tt.name, lines, tt.lines)
+		}
+		if !m.saveFile() {
+			t.Fatalf("%s: save failed: %s", tt.name, m.statusMsg)
+		}
+		if got, _ := os.ReadFile(path); string(got) != tt.data {
+			t.Errorf("%s: saved %q, want %q", tt.name, got, tt.data)
+		}
+	}
+}
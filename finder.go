@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxFinderFiles caps how many files the finder collects, so opening it in a
+// huge tree stays quick.
+const maxFinderFiles = 10000
+
+// listFiles returns the files under dir, relative to it, leaving out hidden
+// files and directories.
+func listFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip what can't be read
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, rel)
+			if len(files) == maxFinderFiles {
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// openFinder lists the files under the current directory to pick one to
+// open, starting with query typed in.
+func (m *model) openFinder(query string) {
+	files, err := listFiles(".")
+	if err != nil {
+		m.statusMsg = "Error listing files: " + err.Error()
+		return
+	}
+	m.finderFiles = files
+	m.finderQuery = query
+	m.mode = finderMode
+	m.filterFinder()
+}
+
+// filterFinder keeps the files whose path holds the query, ignoring case,
+// and selects the first of them.
+func (m *model) filterFinder() {
+	query := strings.ToLower(m.finderQuery)
+	m.finderResults = m.finderResults[:0]
+	for _, f := range m.finderFiles {
+		if strings.Contains(strings.ToLower(f), query) {
+			m.finderResults = append(m.finderResults, f)
+		}
+	}
+	m.finderIndex = 0
+	m.showFinder()
+}
+
+// showFinder shows the query and the number of files it matches.
+func (m *model) showFinder() {
+	m.statusMsg = "Find: " + m.finderQuery + " (" + strconv.Itoa(len(m.finderResults)) + " of " + strconv.Itoa(len(m.finderFiles)) + ")"
+}
+
+// handleFinderMode filters the file list as the query is typed, moves
+// through it, and opens the selected file on Enter.
+func (m model) handleFinderMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.mode = normalMode
+		m.statusMsg = ""
+	case "enter":
+		m.mode = normalMode
+		if len(m.finderResults) == 0 {
+			m.statusMsg = "No file matches " + m.finderQuery
+			break
+		}
+		m.edit(m.finderResults[m.finderIndex], false)
+	case "up", "ctrl+p", "ctrl+k":
+		m.finderIndex = max(m.finderIndex-1, 0)
+	case "down", "ctrl+n", "ctrl+j":
+		m.finderIndex = min(m.finderIndex+1, max(len(m.finderResults)-1, 0))
+	case "backspace":
+		if runes := []rune(m.finderQuery); len(runes) > 0 {
+			m.finderQuery = string(runes[:len(runes)-1])
+			m.filterFinder()
+		}
+	default:
+		if len(msg.Runes) == 1 {
+			m.finderQuery += string(msg.Runes[0])
+			m.filterFinder()
+		}
+	}
+	return m, nil
+}
+
+// renderFinder writes the files matching the query over the text area.
+func (m model) renderFinder(s *strings.Builder) {
+	m.renderList(s, len(m.finderResults), m.finderIndex, func(i int) string {
+		return m.finderResults[i]
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// foldRange is a closed fold hiding the lines start to end behind a single
+// placeholder row.
+type foldRange struct {
+	start, end int
+}
+
+// toggleFold opens the fold at the cursor, or folds the indented block
+// starting on the cursor line.
+func (m *model) toggleFold() {
+	if i := m.foldAt(m.cursorY); i >= 0 {
+		m.folds = slices.Delete(m.folds, i, i+1)
+		return
+	}
+	end := indentedBlockEnd(m.content, m.cursorY, m.tabSize)
+	if end == m.cursorY {
+		m.statusMsg = "No indented block to fold"
+		return
+	}
+	m.folds = append(m.folds, foldRange{m.cursorY, end})
+	m.adjustOffset()
+}
+
+// foldAt returns the index of the outermost fold hiding line y, or -1 if the
+// line is visible.
+func (m model) foldAt(y int) int {
+	found := -1
+	for i, f := range m.folds {
+		if f.start <= y && y <= f.end && (found < 0 || f.start < m.folds[found].start) {
+			found = i
+		}
+	}
+	return found
+}
+
+// openFoldsAt opens the folds that hide line y behind another line.
+func (m *model) openFoldsAt(y int) {
+	m.folds = slices.DeleteFunc(m.folds, func(f foldRange) bool {
+		return f.start < y && y <= f.end
+	})
+}
+
+// nextVisibleLine returns the line shown on the row below line y, which may
+// be past the end of the buffer.
+func (m model) nextVisibleLine(y int) int {
+	if f := m.foldAt(y); f >= 0 {
+		return m.folds[f].end + 1
+	}
+	return y + 1
+}
+
+// prevVisibleLine returns the line shown on the row above line y.
+func (m model) prevVisibleLine(y int) int {
+	y--
+	if f := m.foldAt(y); f >= 0 {
+		return m.folds[f].start
+	}
+	return y
+}
+
+// lineAfterRows returns the first line that doesn't fit in the given number
+// of rows starting at line y.
+func (m model) lineAfterRows(y, rows int) int {
+	if len(m.folds) == 0 && !m.wrap {
+		return y + rows
+	}
+	for y < len(m.content) {
+		if rows -= len(m.rowStarts(y)); rows < 0 {
+			break
+		}
+		y = m.nextVisibleLine(y)
+	}
+	return y
+}
+
+// shiftFolds keeps folds on their lines after n lines were inserted at y, or
+// after -n lines were removed from y onwards. Folds the edit reaches into
+// are dropped.
+func (m *model) shiftFolds(y, n int) {
+	// Inserted lines reach into a fold they land after the start of
+	end := y
+	if n < 0 {
+		end = y - n
+	}
+	m.folds = slices.DeleteFunc(m.folds, func(f foldRange) bool {
+		return f.end >= y && f.start < end
+	})
+	for i, f := range m.folds {
+		if f.start >= y {
+			m.folds[i] = foldRange{f.start + n, f.end + n}
+		}
+	}
+}
+
+// renderFold returns the placeholder row of a fold.
+func (m model) renderFold(f foldRange, cursor bool) string {
+	header := strings.TrimSpace(string(m.content[f.start]))
+	text := []rune(fmt.Sprintf("+--%3d lines: %s", f.end-f.start+1, header))
+	text = text[:min(len(text), m.textWidth())]
+	style := foldStart
+	if cursor {
+		style += cursorStart
+	}
+	return style + string(text) + styleReset
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"go/format"
+	"strings"
+)
+
+// formatGo runs the buffer through gofmt as one undo action. The cursor
+// stays on its line: the nearest formatted line that differs from it only in
+// spacing, or failing that the line at the same place. It keeps its column
+// relative to the indentation, which is mostly what formatting changes. A
+// buffer that doesn't parse is left as it is.
+func (m *model) formatGo() error {
+	formatted, err := format.Source([]byte(m.text()))
+	if err != nil {
+		return err
+	}
+	lines, finalNewline := splitLines(formatted)
+	start, oldEnd, newEnd := diffLines(m.content, lines)
+	if start == oldEnd && start == newEnd {
+		return nil
+	}
+
+	m.saveAction() // Save current state for undo
+	old := m.content[m.cursorY]
+	offset := m.cursorX - firstNonBlank(old)
+	switch {
+	case m.cursorY >= oldEnd:
+		m.cursorY += newEnd - oldEnd
+	case m.cursorY >= start:
+		m.cursorY = sameLine(lines[start:newEnd], old, m.cursorY-start) + start
+	}
+	m.changeLines(start, oldEnd)
+	m.content = lines
+	m.finalNewline = finalNewline
+	m.folds = nil // The formatted lines may not match them
+	m.cursorY = min(m.cursorY, len(m.content)-1)
+	line := m.content[m.cursorY]
+	m.cursorX = max(min(firstNonBlank(line)+offset, len(line)), 0)
+	m.modified = true
+	m.adjustOffset()
+	return nil
+}
+
+// sameLine returns the index of the line in lines nearest to y that equals
+// line apart from spaces and tabs, or y brought within lines when none does.
+func sameLine(lines [][]rune, line []rune, y int) int {
+	want := withoutBlanks(line)
+	for d := 0; d < len(lines)+y; d++ {
+		for _, i := range []int{y - d, y + d} {
+			if i >= 0 && i < len(lines) && withoutBlanks(lines[i]) == want {
+				return i
+			}
+		}
+	}
+	return max(min(y, len(lines)-1), 0)
+}
+
+// withoutBlanks returns line with its spaces and tabs removed.
+func withoutBlanks(line []rune) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, string(line))
+}
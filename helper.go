@@ -1,10 +1,86 @@
 package main
 
 import (
-	"fmt"
-	"strings"
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	highlightStart = "\033[43m"       // Yellow background
+	currentStart   = "\033[48;5;208m" // Orange background
+	selectStart    = "\033[48;5;24m"  // Blue background
+	cursorLineBg   = "\033[48;5;236m" // Dark grey background
+	keywordStart   = "\033[35m"       // Magenta
+	stringStart    = "\033[32m"       // Green
+	numberStart    = "\033[36m"       // Cyan
+	commentStart   = "\033[90m"       // Grey
+	cursorStart    = "\033[7m"        // Reverse video block
+	barStart       = "\033[4m"        // Underline
+	foldStart      = "\033[36m"       // Cyan
+	trackStart     = "\033[48;5;236m" // Dark grey background
+	thumbStart     = "\033[48;5;245m" // Light grey background
+	styleReset     = "\033[0m"
 )
 
+// cellStyle is a set of highlights applied to a rune when rendering.
+type cellStyle uint16
+
+const (
+	styleSearch cellStyle = 1 << iota
+	styleSelect
+	styleKeyword
+	styleString
+	styleNumber
+	styleComment
+	styleCursorLine
+	styleCursor
+	styleBar
+	styleCurrentMatch
+)
+
+// sequence returns the escape sequence that turns on style. Syntax colors
+// are foregrounds so they show through the backgrounds, among which the
+// selection wins over search highlighting, which wins over the cursor line.
+// The match under the cursor stands out from the other matches.
+// The cursor is drawn on top of all of them.
+func (s cellStyle) sequence() string {
+	var seq string
+	switch {
+	case s&styleKeyword != 0:
+		seq = keywordStart
+	case s&styleString != 0:
+		seq = stringStart
+	case s&styleNumber != 0:
+		seq = numberStart
+	case s&styleComment != 0:
+		seq = commentStart
+	}
+	switch {
+	case s&styleSelect != 0:
+		seq += selectStart
+	case s&styleCurrentMatch != 0:
+		seq += currentStart
+	case s&styleSearch != 0:
+		seq += highlightStart
+	case s&styleCursorLine != 0:
+		seq += cursorLineBg
+	}
+	switch {
+	case s&styleCursor != 0:
+		seq += cursorStart
+	case s&styleBar != 0:
+		seq += barStart
+	}
+	return seq
+}
+
 func deepCopyContent(content [][]rune) [][]rune {
 	newContent := make([][]rune, len(content))
 	for i, line := range content {
@@ -14,31 +90,339 @@ func deepCopyContent(content [][]rune) [][]rune {
 	return newContent
 }
 
-func highlightSearch(text, searchTerm string) string {
-	if searchTerm == "" {
-		return text
+func equalContent(a, b [][]rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !slices.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchMatches returns the [start, end) rune ranges of every non-empty
+// match of re in line. A nil re matches nothing.
+func searchMatches(line []rune, re *regexp.Regexp) [][2]int {
+	if re == nil {
+		return nil
 	}
 
-	highlightStyle := "\033[43m%s\033[0m" // Yellow background
-	parts := strings.Split(text, searchTerm)
-	for i := 0; i < len(parts)-1; i++ {
-		parts[i] += fmt.Sprintf(highlightStyle, searchTerm)
+	text := string(line)
+	var matches [][2]int
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		start := utf8.RuneCountInString(text[:loc[0]])
+		end := start + utf8.RuneCountInString(text[loc[0]:loc[1]])
+		matches = append(matches, [2]int{start, end})
 	}
-	return strings.Join(parts, "")
+	return matches
+}
+
+// wideTail fills the cell taken by the right half of a double-width rune.
+const wideTail rune = -1
+
+// runeWidth returns the number of columns r takes on screen. Zero-width and
+// control runes still get a column of their own.
+func runeWidth(r rune) int {
+	return max(runewidth.RuneWidth(r), 1)
 }
 
-func expandTabs(s string, tabSize int) string {
-	var result strings.Builder
+// displayColumn returns the screen column of rune index x once tabs are
+// expanded and wide runes take their double column.
+func displayColumn(line []rune, x, tabSize int) int {
 	column := 0
-	for _, r := range s {
-		if r == '\t' {
-			spaces := tabSize - (column % tabSize)
-			result.WriteString(strings.Repeat(" ", spaces))
-			column += spaces
+	for i := 0; i < x && i < len(line); i++ {
+		if line[i] == '\t' {
+			column += tabSize - (column % tabSize)
 		} else {
-			result.WriteRune(r)
-			column++
+			column += runeWidth(line[i])
+		}
+	}
+	if x > len(line) {
+		column += x - len(line)
+	}
+	return column
+}
+
+// runeAtColumn returns the index of the rune shown at screen column col once
+// tabs are expanded, or len(line) for a column past the end of the line.
+func runeAtColumn(line []rune, col, tabSize int) int {
+	cells, source := expandTabs(line, tabSize)
+	if col >= len(cells) {
+		return len(line)
+	}
+	return source[col]
+}
+
+// expandTabs expands tabs in line into display cells, returning the cells
+// together with the index of the rune each cell came from. A double-width
+// rune is followed by a wideTail cell.
+func expandTabs(line []rune, tabSize int) ([]rune, []int) {
+	size := len(line)
+	for _, r := range line {
+		if r == '\t' {
+			size += tabSize - 1 // Enough for any tab, so cells rarely grow
+		}
+	}
+	cells := make([]rune, 0, size)
+	source := make([]int, 0, size)
+	for i, r := range line {
+		switch {
+		case r == '\t':
+			for n := tabSize - len(cells)%tabSize; n > 0; n-- {
+				cells = append(cells, ' ')
+				source = append(source, i)
+			}
+		case runeWidth(r) > 1:
+			cells = append(cells, r, wideTail)
+			source = append(source, i, i)
+		default:
+			cells = append(cells, r)
+			source = append(source, i)
+		}
+	}
+	return cells, source
+}
+
+// showWhitespace marks the cells of tabs with a » at their start and those of
+// trailing spaces with a middle dot.
+func showWhitespace(cells []rune, source []int, line []rune) {
+	trailing := len(line)
+	for trailing > 0 && unicode.IsSpace(line[trailing-1]) {
+		trailing--
+	}
+	for c, i := range source {
+		switch {
+		case line[i] == '\t' && (c == 0 || source[c-1] != i):
+			cells[c] = '»'
+		case line[i] == ' ' && i >= trailing:
+			cells[c] = '·'
+		}
+	}
+}
+
+// isWordChar reports whether r belongs to a word: a letter, digit or
+// underscore.
+func isWordChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Rune classes shared by the word motions. A word is a run of runes of the
+// same non-blank class.
+const (
+	blankClass = iota
+	punctClass
+	wordClass
+)
+
+func charClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return blankClass
+	case isWordChar(r):
+		return wordClass
+	default:
+		return punctClass
+	}
+}
+
+// nextWordStart returns the index of the first word after x in line, or
+// len(line) if no word follows on this line.
+func nextWordStart(line []rune, x int) int {
+	if x < len(line) {
+		class := charClass(line[x])
+		for x < len(line) && class != blankClass && charClass(line[x]) == class {
+			x++
+		}
+	}
+	for x < len(line) && charClass(line[x]) == blankClass {
+		x++
+	}
+	return x
+}
+
+// prevWordStart returns the index of the start of the word before x in line,
+// or -1 if no word precedes it on this line.
+func prevWordStart(line []rune, x int) int {
+	x = min(x, len(line)) - 1
+	for x >= 0 && charClass(line[x]) == blankClass {
+		x--
+	}
+	if x < 0 {
+		return -1
+	}
+	class := charClass(line[x])
+	for x > 0 && charClass(line[x-1]) == class {
+		x--
+	}
+	return x
+}
+
+// wordEnd returns the index of the last rune of the word ending after x in
+// line, or -1 if no word ends after x on this line.
+func wordEnd(line []rune, x int) int {
+	x++
+	for x < len(line) && charClass(line[x]) == blankClass {
+		x++
+	}
+	if x >= len(line) {
+		return -1
+	}
+	class := charClass(line[x])
+	for x+1 < len(line) && charClass(line[x+1]) == class {
+		x++
+	}
+	return x
+}
+
+func toggleRuneCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
+
+// firstNonBlank returns the index of the first non-whitespace rune in line,
+// or len(line) if the line is blank.
+func firstNonBlank(line []rune) int {
+	x := 0
+	for x < len(line) && unicode.IsSpace(line[x]) {
+		x++
+	}
+	return x
+}
+
+// firstNumber returns the first decimal number on line, which may have a
+// leading minus sign.
+func firstNumber(line []rune) (int, bool) {
+	start := slices.IndexFunc(line, unicode.IsDigit)
+	if start < 0 {
+		return 0, false
+	}
+	end := start
+	for end < len(line) && unicode.IsDigit(line[end]) {
+		end++
+	}
+	if start > 0 && line[start-1] == '-' {
+		start--
+	}
+	n, err := strconv.Atoi(string(line[start:end]))
+	return n, err == nil
+}
+
+// splitLines splits file data into lines, reporting whether it ended with a
+// newline. Empty data gives a single empty line, and the final newline does
+// not start another line. The lines share a single array of runes, which
+// makes big files much quicker to load than converting each line
+// separately. Each line's capacity ends with it, so growing a line never
+// overwrites the next one.
+func splitLines(data []byte) ([][]rune, bool) {
+	text, finalNewline := bytes.CutSuffix(data, []byte("\n"))
+	runes := make([]rune, utf8.RuneCount(text))
+	content := make([][]rune, 0, bytes.Count(text, []byte("\n"))+1)
+	start, n := 0, 0
+	for len(text) > 0 {
+		r, size := rune(text[0]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRune(text)
+		}
+		text = text[size:]
+		if r == '\n' {
+			content = append(content, runes[start:n:n])
+			start = n
+			continue
+		}
+		runes[n] = r
+		n++
+	}
+	return append(content, runes[start:n:n]), finalNewline
+}
+
+// resolvePath returns the absolute form of path, or path itself if it can't
+// be resolved.
+func resolvePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// isCountDigit reports whether key extends a count prefix. A 0 only does so
+// once a count is pending, otherwise it is the start-of-line motion.
+func isCountDigit(key string, count int) bool {
+	if len(key) != 1 || key[0] < '0' || key[0] > '9' {
+		return false
+	}
+	return key[0] != '0' || count > 0
+}
+
+var bracketPairs = map[rune]rune{'(': ')', '[': ']', '{': '}', ')': '(', ']': '[', '}': '{'}
+
+// matchBracket returns the position of the bracket matching the one at line y,
+// column x, scanning forward from an opening bracket and backward from a
+// closing one while skipping nested pairs.
+func matchBracket(content [][]rune, y, x int) (int, int, bool) {
+	if x >= len(content[y]) {
+		return 0, 0, false
+	}
+	from := content[y][x]
+	to, ok := bracketPairs[from]
+	if !ok {
+		return 0, 0, false
+	}
+	step := 1
+	switch from {
+	case ')', ']', '}':
+		step = -1
+	}
+
+	depth := 0
+	for {
+		switch content[y][x] {
+		case from:
+			depth++
+		case to:
+			depth--
+			if depth == 0 {
+				return y, x, true
+			}
+		}
+		// Step to the next rune, moving across lines as needed
+		x += step
+		for x < 0 || x >= len(content[y]) {
+			y += step
+			if y < 0 || y >= len(content) {
+				return 0, 0, false
+			}
+			if step > 0 {
+				x = 0
+			} else {
+				x = len(content[y]) - 1
+			}
+		}
+	}
+}
+
+// indentedBlockEnd returns the last line of the block below line y that is
+// indented further than y, or y itself if there is none. Blank lines only
+// belong to the block when more of it follows.
+func indentedBlockEnd(content [][]rune, y, tabSize int) int {
+	indentOf := func(line []rune) int {
+		return displayColumn(line, firstNonBlank(line), tabSize)
+	}
+	indent, end := indentOf(content[y]), y
+	for i := y + 1; i < len(content); i++ {
+		if firstNonBlank(content[i]) == len(content[i]) {
+			continue
+		}
+		if indentOf(content[i]) <= indent {
+			break
 		}
+		end = i
 	}
-	return result.String()
+	return end
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisplayColumnWithWideRunes(t *testing.T) {
+	line := []rune("a😀b日本\tz")
+	tests := []struct{ x, column int }{
+		{0, 0},  // a
+		{1, 1},  // 😀, two columns wide
+		{2, 3},  // b
+		{3, 4},  // 日
+		{4, 6},  // 本
+		{5, 8},  // Tab to the next multiple of four
+		{6, 12}, // z
+		{7, 13}, // Past the end
+	}
+	for _, tt := range tests {
+		if got := displayColumn(line, tt.x, 4); got != tt.column {
+			t.Errorf("displayColumn(%d) = %d, want %d", tt.x, got, tt.column)
+		}
+		if tt.x < len(line) {
+			if got := runeAtColumn(line, tt.column, 4); got != tt.x {
+				t.Errorf("runeAtColumn(%d) = %d, want %d", tt.column, got, tt.x)
+			}
+		}
+	}
+	// Both halves of a wide rune belong to it
+	if got := runeAtColumn(line, 5, 4); got != 3 {
+		t.Errorf("runeAtColumn(5) = %d, want 3", got)
+	}
+}
+
+func TestCursorOnWideRune(t *testing.T) {
+	m := press(newTestModel("a😀b日本"), "l", "l", "l")
+	row := strings.Split(m.View(), "\n")[0]
+	if !strings.Contains(row, cursorStart+"日"+styleReset) {
+		t.Errorf("cursor not drawn on 日: %q", row)
+	}
+}
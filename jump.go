@@ -0,0 +1,56 @@
+package main
+
+// maxJumps is how many positions the jump list remembers.
+const maxJumps = 100
+
+// pushJump remembers the cursor position before a jump, so Ctrl+O can come
+// back to it. Jumping from a position that was gone back to forgets the
+// positions after it, and an older entry on the same line is dropped.
+func (m *buffer) pushJump() {
+	jumps := m.jumps[:min(m.jumpIndex, len(m.jumps))]
+	for i := 0; i < len(jumps); i++ {
+		if jumps[i][0] == m.cursorY {
+			jumps = append(jumps[:i], jumps[i+1:]...)
+			i--
+		}
+	}
+	jumps = append(jumps, [2]int{m.cursorY, m.cursorX})
+	if len(jumps) > maxJumps {
+		jumps = jumps[len(jumps)-maxJumps:]
+	}
+	m.jumps = jumps
+	m.jumpIndex = len(jumps)
+}
+
+// jumpBack moves the cursor to the position before the last jump for Ctrl+O.
+func (m *model) jumpBack() {
+	if m.jumpIndex == 0 {
+		m.statusMsg = "At start of jump list"
+		return
+	}
+	if m.jumpIndex == len(m.jumps) {
+		// Keep where the cursor is so Ctrl+I can return to it
+		m.jumps = append(m.jumps, [2]int{m.cursorY, m.cursorX})
+	}
+	m.jumpIndex--
+	m.goToJump()
+}
+
+// jumpForward goes forward again through the jump list for Ctrl+I.
+func (m *model) jumpForward() {
+	if m.jumpIndex+1 >= len(m.jumps) {
+		m.statusMsg = "At end of jump list"
+		return
+	}
+	m.jumpIndex++
+	m.goToJump()
+}
+
+// goToJump moves the cursor to the current entry of the jump list, or as
+// close to it as the buffer still allows after edits.
+func (m *model) goToJump() {
+	pos := m.jumps[m.jumpIndex]
+	m.cursorY = min(pos[0], len(m.content)-1)
+	m.cursorX = min(pos[1], len(m.content[m.cursorY]))
+	m.adjustOffset()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxMacroDepth limits how deeply macros may replay each other, so a macro
+// calling itself comes to an end.
+const maxMacroDepth = 100
+
+// startRecording records the keys typed from now on into the macro r, until
+// q is pressed again.
+func (m *model) startRecording(r rune) {
+	if !unicode.IsLetter(r) {
+		m.statusMsg = "Invalid register name: " + string(r)
+		return
+	}
+	m.recording = unicode.ToLower(r)
+	m.macros[m.recording] = nil
+	m.statusMsg = "recording @" + string(m.recording)
+}
+
+// stopRecording ends the recording, leaving out the q that stopped it.
+func (m *model) stopRecording() {
+	keys := m.macros[m.recording]
+	m.macros[m.recording] = keys[:max(len(keys)-1, 0)]
+	m.statusMsg = "Recorded @" + string(m.recording)
+	m.recording = 0
+}
+
+// replayMacro feeds the keys of macro r back through Update count times. @
+// replays the last macro run.
+func (m model) replayMacro(r rune, count int) (tea.Model, tea.Cmd) {
+	if r == '@' {
+		r = m.lastMacro
+	}
+	r = unicode.ToLower(r)
+	keys, ok := m.macros[r]
+	if !ok {
+		m.statusMsg = "No macro recorded in @" + string(r)
+		return m, nil
+	}
+	if m.macroDepth >= maxMacroDepth {
+		m.statusMsg = "Macro recursion too deep"
+		return m, nil
+	}
+	m.lastMacro = r
+
+	// The keys were recorded already, and only the @ command is recorded
+	// again
+	recording := m.recording
+	m.recording = 0
+	m.macroDepth++
+	var cmds []tea.Cmd
+	for range count {
+		for _, msg := range keys {
+			next, cmd := m.Update(msg)
+			m = next.(model)
+			cmds = append(cmds, cmd)
+		}
+	}
+	m.macroDepth--
+	m.recording = recording
+	return m, tea.Batch(cmds...)
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"unicode"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -17,265 +25,658 @@ const (
 	insertMode
 	searchMode
 	replaceMode
+	commandMode
+	promptMode
+	confirmMode
+	visualMode
+	matchesMode
+	finderMode
 )
 
-type action struct {
-	content [][]rune
-	cursorX int
-	cursorY int
+// String returns the name of the mode shown in the status bar.
+func (m mode) String() string {
+	switch m {
+	case normalMode:
+		return "NORMAL"
+	case insertMode:
+		return "INSERT"
+	case searchMode:
+		return "SEARCH"
+	case replaceMode:
+		return "REPLACE"
+	case commandMode:
+		return "COMMAND"
+	case promptMode:
+		return "PROMPT"
+	case confirmMode:
+		return "CONFIRM"
+	case visualMode:
+		return "VISUAL"
+	case matchesMode:
+		return "MATCHES"
+	case finderMode:
+		return "FIND"
+	}
+	return "mode(" + strconv.Itoa(int(m)) + ")"
+}
+
+// viewPos is a cursor position together with the scroll offsets showing it.
+type viewPos struct {
+	cursorX, cursorY, offsetX, offsetY int
 }
 
 type model struct {
-	content     [][]rune
-	cursorX     int
-	cursorY     int
-	offsetY     int
-	width       int
-	height      int
-	mode        mode
-	filename    string
-	statusMsg   string
-	searchTerm  string
-	replaceTerm string
-	clipboard   string
-	modified    bool
-	tabSize     int
-	undoStack   []action
-	redoStack   []action
-}
-
-func initialModel(filename string) model {
-	content := [][]rune{{}}
-	if filename != "" {
-		if data, err := os.ReadFile(filename); err == nil {
-			lines := strings.Split(string(data), "\n")
-			content = make([][]rune, len(lines))
-			for i, line := range lines {
-				content[i] = []rune(line)
+	buffer
+	buffers            []buffer // Open buffers, the active one is only stored on switching away
+	bufferIndex        int
+	split              bool // Whether a second pane shows another buffer
+	splitBuffer        int  // Buffer shown in the pane without focus
+	splitBelow         bool // Whether the pane without focus is the lower one
+	selStartX          int
+	selStartY          int
+	selLinewise        bool
+	visualLines        [2]int   // First and last line of the selection a :'<,'> command applies to
+	matches            [][2]int // Line and column of each match listed by :matches
+	matchIndex         int      // Match selected in the list
+	finderFiles        []string // Files under the current directory the finder picks from
+	finderQuery        string
+	finderResults      []string // Files matching finderQuery
+	finderIndex        int      // File selected in finderResults
+	completions        []string // Word typed before Ctrl+N followed by its completions
+	completionIndex    int      // Completion in the buffer, 0 for the typed word
+	completionStart    int      // Column the completed word starts at
+	readOnly           bool     // Whether edits to the buffer are refused
+	keymap             string   // Key bindings, vimKeymap or emacsKeymap
+	killed             bool     // Whether the last emacs command was Ctrl+K, which the next one adds to
+	width              int
+	height             int // Text rows of the focused pane
+	rows               int // Text rows of the whole screen
+	mode               mode
+	statusMsg          string
+	searchTerm         string
+	searchPrev         string  // Search term to restore when a search is cancelled
+	searchOrigin       viewPos // Where the search started
+	searchHistory      []string
+	searchHistoryIndex int // Entry shown by Up/Down; len(searchHistory) is the term being typed
+	searchIgnoreCase   bool
+	searchWrap         bool
+	searchRegex        bool
+	hlsearch           bool // Keep matches highlighted after a search
+	undoLevels         int  // Most undo entries kept per buffer
+	undoHeld           bool // Set while repeat collapses edits into one undo entry
+	noHighlight        bool // Highlighting hidden by :noh until the next search
+	replaceTerm        string
+	replacePattern     *regexp.Regexp
+	replaceMatchEnd    int
+	replaceCount       int
+	commandBuffer      string
+	promptLabel        string
+	promptInput        string
+	promptAction       func(m *model, input string) tea.Cmd
+	clipboard          string
+	clipboardLinewise  bool // Whether the clipboard holds whole lines rather than text within a line
+	registers          map[rune]string
+	linewiseRegisters  map[rune]bool // Named registers holding whole lines
+	macros             map[rune][]tea.KeyMsg
+	recording          rune // Macro the typed keys are recorded into, 0 when none
+	lastMacro          rune // Macro replayed by @@
+	macroDepth         int  // Macros being replayed, each by the one before
+	register           rune
+	pendingOp          string // Keys of a command waiting for more, "" when none
+	count              int    // Count typed before a command, 0 when none
+	tabSize            int
+	expandTab          bool
+	autoIndent         bool
+	autoPairs          bool   // Whether brackets and quotes typed are closed
+	gofmt              bool   // Whether Go files are formatted when saved
+	number             bool   // Whether to show line numbers
+	wrap               bool   // Whether to wrap long lines instead of scrolling sideways
+	statusFormat       string // Layout of the status bar, see statusLine
+	scrollbar          bool   // Whether to show a scrollbar on the right edge
+	relativeNumbers    bool
+	syntax             bool // Whether to highlight the syntax of known file types
+	cursorLine         bool // Whether to tint the line the cursor is on
+	list               bool // Whether to make tabs and trailing spaces visible
+	autosave           int  // Seconds between autosaves, 0 when off
+	autosaveGen        int  // Tells ticks of the current interval apart
+	backup             bool // Whether to back up the file before first overwriting it
+	changeTick         int  // Counts the changes pushed onto the undo stack
+	changeStart        int  // changeTick when the command in changeKeys began
+	changeKeys         []tea.KeyMsg
+	lastChange         []tea.KeyMsg // Keys of the last change, replayed by .
+}
+
+func initialModel(filenames ...string) model {
+	m := model{
+		mode:              normalMode,
+		keymap:            vimKeymap,
+		statusMsg:         "Normal mode",
+		tabSize:           4,
+		searchWrap:        true,
+		hlsearch:          true,
+		undoLevels:        1000,
+		autoIndent:        true,
+		syntax:            true,
+		cursorLine:        true,
+		number:            true,
+		statusFormat:      defaultStatusFormat,
+		registers:         make(map[rune]string),
+		linewiseRegisters: make(map[rune]bool),
+		macros:            make(map[rune][]tea.KeyMsg),
+	}
+	if len(filenames) == 0 {
+		filenames = []string{""}
+	}
+	stdinRead := false
+	for _, filename := range filenames {
+		if filename != stdinFilename {
+			m.buffers = append(m.buffers, newBuffer(filename))
+			continue
+		}
+		b := newBuffer("") // The text piped in can only be read once
+		if !stdinRead {
+			var err error
+			if b, err = readBuffer(os.Stdin); err != nil {
+				m.statusMsg = "Error reading standard input: " + err.Error()
 			}
+			stdinRead = true
 		}
+		m.buffers = append(m.buffers, b)
 	}
-	return model{
-		content:   content,
-		cursorX:   0,
-		cursorY:   0,
-		offsetY:   0,
-		mode:      normalMode,
-		filename:  filename,
-		statusMsg: "Normal mode",
-		tabSize:   4,
-	}
+	m.buffer = m.buffers[0]
+	m.offerRecovery()
+	return m
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.ClearScreen
+	return tea.Batch(tea.ClearScreen, scheduleTick(), m.scheduleAutosave())
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch m.mode {
-		case normalMode:
-			return m.handleNormalMode(msg)
-		case insertMode:
-			return m.handleInsertMode(msg)
-		case searchMode:
-			return m.handleSearchMode(msg)
-		case replaceMode:
-			return m.handleReplaceMode(msg)
+		if m.recording != 0 {
+			m.macros[m.recording] = append(m.macros[m.recording], msg)
+		}
+		if m.keymap == emacsKeymap {
+			return m.handleKey(msg) // There is no . to collect the keys for
+		}
+		if m.mode == normalMode && m.pendingOp == "" && msg.String() == "." {
+			return m.repeatChange()
 		}
+		return m.recordChange(msg)
+	case tea.MouseMsg:
+		return m.handleMouse(msg)
+	case autosaveMsg:
+		return m.handleAutosave(msg)
+	case tickMsg:
+		m.updateSwap()
+		m.checkDisk()
+		return m, scheduleTick()
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
-		m.height = msg.Height - 2 // Reserve 2 lines for status bar
+		m.rows = msg.Height - 2 // Reserve 2 lines for status bar
+		m.layout()
 	}
 	return m, nil
 }
 
-func (m *model) saveAction() {
-	m.undoStack = append(m.undoStack, action{
-		content: deepCopyContent(m.content),
-		cursorX: m.cursorX,
-		cursorY: m.cursorY,
-	})
-	m.redoStack = nil // Clear redo stack when a new action is performed
-}
-
-func (m *model) undo() {
-	if len(m.undoStack) > 0 {
-		// Save current state to redo stack
-		m.redoStack = append(m.redoStack, action{
-			content: deepCopyContent(m.content),
-			cursorX: m.cursorX,
-			cursorY: m.cursorY,
-		})
-
-		// Pop the last action from undo stack
-		lastAction := m.undoStack[len(m.undoStack)-1]
-		m.undoStack = m.undoStack[:len(m.undoStack)-1]
-
-		// Apply the last action
-		m.content = deepCopyContent(lastAction.content)
-		m.cursorX = lastAction.cursorX
-		m.cursorY = lastAction.cursorY
-
-		m.modified = true
-		m.statusMsg = "Undo performed"
-	} else {
-		m.statusMsg = "Nothing to undo"
+func (m model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.keymap == emacsKeymap && (m.mode == normalMode || m.mode == insertMode) {
+		return m.handleEmacsKey(msg)
+	}
+	switch m.mode {
+	case normalMode:
+		return m.handleNormalMode(msg)
+	case insertMode:
+		return m.handleInsertMode(msg)
+	case searchMode:
+		return m.handleSearchMode(msg)
+	case replaceMode:
+		return m.handleReplaceMode(msg)
+	case commandMode:
+		return m.handleCommandMode(msg)
+	case promptMode:
+		return m.handlePromptMode(msg)
+	case confirmMode:
+		return m.handleConfirmMode(msg)
+	case visualMode:
+		return m.handleVisualMode(msg)
+	case matchesMode:
+		return m.handleMatchesMode(msg)
+	case finderMode:
+		return m.handleFinderMode(msg)
 	}
+	return m, nil
 }
 
-func (m *model) redo() {
-	if len(m.redoStack) > 0 {
-		// Save current state to undo stack
-		m.undoStack = append(m.undoStack, action{
-			content: deepCopyContent(m.content),
-			cursorX: m.cursorX,
-			cursorY: m.cursorY,
-		})
-
-		// Pop the last action from redo stack
-		lastAction := m.redoStack[len(m.redoStack)-1]
-		m.redoStack = m.redoStack[:len(m.redoStack)-1]
-
-		// Apply the last action
-		m.content = deepCopyContent(lastAction.content)
-		m.cursorX = lastAction.cursorX
-		m.cursorY = lastAction.cursorY
+func (m model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.pendingOp != "" {
+		return m.handlePendingOp(msg)
+	}
+	key := msg.String()
+	if isCountDigit(key, m.count) {
+		m.count = m.count*10 + int(key[0]-'0')
+		m.statusMsg = strconv.Itoa(m.count)
+		return m, nil
+	}
+	count := max(m.count, 1)
+	if key == "g" {
+		m.pendingOp = "g" // Starts gg, gc or g Ctrl+G
+		return m, nil
+	}
+	if key == "G" && m.count > 0 {
+		m.goToLine(m.count) // Like :<count>
+		m.count = 0
+		return m, nil
+	}
+	if m.applyMotion(key) {
+		for range count - 1 {
+			m.applyMotion(key)
+		}
+		m.count = 0
+		return m, nil
+	}
 
-		m.modified = true
-		m.statusMsg = "Redo performed"
-	} else {
-		m.statusMsg = "Nothing to redo"
+	if m.readOnly && editKeys[key] {
+		m.refuseEdit()
+		m.count = 0
+		return m, nil
 	}
-}
 
-func (m model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
+	switch key {
 	case "q":
-		if m.modified {
-			m.statusMsg = "Unsaved changes. Use :q! to force quit."
+		if m.recording != 0 {
+			m.stopRecording()
 		} else {
-			return m, tea.Sequence(tea.ClearScreen, tea.Quit)
+			m.pendingOp = "q"
 		}
+	case "@":
+		m.pendingOp = "@"
 	case "i":
-		m.mode = insertMode
-		m.statusMsg = "Insert mode"
-	case "h", "left":
-		m.moveCursor(-1, 0)
-	case "l", "right":
-		m.moveCursor(1, 0)
-	case "k", "up":
-		m.moveCursor(0, -1)
-	case "j", "down":
-		m.moveCursor(0, 1)
-	case "g":
-		m.cursorY = 0
-		m.offsetY = 0
-	case "G":
-		m.cursorY = len(m.content) - 1
+		m.enterInsertMode()
+	case "a":
+		m.cursorX = min(m.cursorX+1, len(m.content[m.cursorY]))
+		m.enterInsertMode()
 		m.adjustOffset()
-	case "0":
-		m.cursorX = 0
-	case "$":
+	case "A":
 		m.cursorX = len(m.content[m.cursorY])
+		m.enterInsertMode()
+		m.adjustOffset()
+	case "v":
+		m.enterVisualMode(false)
+	case "V":
+		m.enterVisualMode(true)
+	case "o":
+		m.openLine(m.cursorY + 1)
+	case "O":
+		m.openLine(m.cursorY)
 	case "x":
-		if m.cursorX < len(m.content[m.cursorY]) {
-			m.content[m.cursorY] = append(m.content[m.cursorY][:m.cursorX], m.content[m.cursorY][m.cursorX+1:]...)
-			m.modified = true
-		}
+		m.deleteChars(count)
 	case "d":
-		if m.cursorY < len(m.content)-1 {
-			m.clipboard = string(m.content[m.cursorY])
-			m.content = append(m.content[:m.cursorY], m.content[m.cursorY+1:]...)
-			m.modified = true
-			if m.cursorY >= len(m.content) {
-				m.cursorY = len(m.content) - 1
-			}
-		}
+		m.pendingOp = "d"
+	case "c":
+		m.pendingOp = "c"
+	case "r":
+		m.pendingOp = "r"
+	case "z":
+		m.pendingOp = "z"
+	case "Z":
+		m.pendingOp = "Z" // Starts ZZ or ZQ
+	case "C":
+		m.changeToEnd()
+	case "D":
+		m.deleteToEnd()
+	case "\"":
+		m.pendingOp = "\""
+	case "m":
+		m.pendingOp = "m"
+	case "`":
+		m.pendingOp = "`"
+	case ">", "<":
+		m.pendingOp = msg.String()
+	case "J":
+		// Like vim, a count is the number of lines joined, not of joins.
+		m.repeat(max(count-1, 1), m.joinLines)
+	case "~":
+		m.repeat(count, m.toggleCase)
+	case "ctrl+a":
+		m.addToNumber(count)
+	case "ctrl+x":
+		m.addToNumber(-count)
 	case "u":
 		m.undo()
 	case "ctrl+r":
 		m.redo()
 	case "y":
 		if m.cursorY < len(m.content) {
-			m.clipboard = string(m.content[m.cursorY])
 			m.statusMsg = "Line yanked to clipboard"
+			m.yankText(string(m.content[m.cursorY])+"\n", true)
 		}
-	case "p":
-		if m.clipboard != "" {
+	case "p", "P":
+		if text, linewise := m.registerText(); text != "" {
 			m.saveAction() // Save current state for undo
-			m.content = append(m.content[:m.cursorY+1], m.content[m.cursorY:]...)
-			m.content[m.cursorY+1] = []rune(m.clipboard)
-			m.cursorY++
-			m.modified = true
-			m.statusMsg = "Line pasted from clipboard"
+			before := msg.String() == "P"
+			if linewise {
+				// Below the cursor line, or at the top of a buffer without lines
+				at := min(m.cursorY+1, len(m.content))
+				if before {
+					at = m.cursorY
+				}
+				m.pasteLines(at, text, count)
+				m.statusMsg = "Line pasted from clipboard"
+			} else {
+				if !before && m.cursorY < len(m.content) && m.cursorX < len(m.content[m.cursorY]) {
+					m.cursorX++ // After the cursor
+				}
+				m.pasteChars(strings.Repeat(text, count))
+				m.statusMsg = "Text pasted from clipboard"
+			}
 		}
 	case "/":
-		m.mode = searchMode
-		m.statusMsg = "/"
-		m.searchTerm = ""
+		m.startSearch()
 	case "n":
+		m.pushJump()
 		m.findNext()
 	case "N":
+		m.pushJump()
 		m.findPrevious()
+	case "*", "#":
+		m.searchWordUnderCursor(msg.String() == "*")
+	case "ctrl+p":
+		m.openFinder("")
+	case "ctrl+o":
+		m.jumpBack()
+	case "tab": // Terminals send Ctrl+I as Tab
+		m.jumpForward()
+	case "ctrl+w":
+		if m.split {
+			m.switchBuffer(m.splitBuffer)
+		}
 	case ":":
+		m.mode = commandMode
+		m.commandBuffer = ""
 		m.statusMsg = ":"
-	case "w":
-		if m.statusMsg == ":" {
-			m.saveFile()
-		}
-	case "q!":
-		if m.statusMsg == ":" {
-			return m, tea.Sequence(tea.ClearScreen, tea.Quit)
-		}
 	case "ctrl+c":
 		return m, tea.Sequence(tea.ClearScreen, tea.Quit)
+	}
+	if m.pendingOp == "" {
+		m.count = 0 // An operator keeps the count for its second key
+	}
+	return m, nil
+}
+
+// editKeys are the normal mode keys that change the buffer or start doing so.
+var editKeys = map[string]bool{
+	"i": true, "a": true, "A": true, "o": true, "O": true, "x": true,
+	"d": true, "c": true, "r": true, "C": true, "D": true, "J": true,
+	"~": true, "p": true, "P": true, ">": true, "<": true, "u": true,
+	"ctrl+a": true, "ctrl+x": true, "ctrl+r": true,
+}
+
+// refuseEdit reports that a read-only buffer can't be changed.
+func (m *model) refuseEdit() {
+	m.statusMsg = "W10: Warning: Changing a readonly file"
+}
+
+// applyMotion moves the cursor for a motion key shared by normal and visual
+// mode, reporting whether key was a motion.
+func (m *model) applyMotion(key string) bool {
+	switch key {
+	case "h", "left":
+		m.moveCursor(-1, 0)
+	case "l", "right":
+		m.moveCursor(1, 0)
+	case "k", "up":
+		m.moveCursor(0, -1)
+	case "j", "down":
+		m.moveCursor(0, 1)
+	case "gg":
+		m.pushJump()
+		m.cursorY = 0
+		m.cursorX = firstNonBlank(m.content[0])
+		m.adjustOffset()
+	case "G":
+		m.pushJump()
+		m.cursorY = len(m.content) - 1
+		m.cursorX = firstNonBlank(m.content[m.cursorY])
+		m.adjustOffset()
+	case "0":
+		m.cursorX = 0
+		m.adjustOffset()
+	case "$":
+		m.cursorX = len(m.content[m.cursorY])
+		m.adjustOffset()
+	case "w":
+		m.wordForward()
+	case "b":
+		m.wordBackward()
+	case "e":
+		m.wordEndForward()
+	case "%":
+		if y, x, ok := matchBracket(m.content, m.cursorY, m.cursorX); ok {
+			m.pushJump()
+			m.cursorY, m.cursorX = y, x
+			m.adjustOffset()
+		} else {
+			m.statusMsg = "No matching bracket"
+		}
 	case "pageup":
 		m.moveCursor(0, -m.height)
 	case "pagedown":
 		m.moveCursor(0, m.height)
+	case "H", "M", "L":
+		m.jumpToScreenLine(key)
+	case "ctrl+d":
+		m.scrollHalfPage(true)
+	case "ctrl+u":
+		m.scrollHalfPage(false)
+	default:
+		return false
+	}
+	return true
+}
+
+// handlePendingOp completes an operator key such as "d" with the key typed
+// after it. Any key that doesn't complete the operator cancels it.
+func (m model) handlePendingOp(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	op, count := m.pendingOp, max(m.count, 1)
+	given := m.count
+	m.pendingOp, m.count = "", 0
+	switch op {
+	case "g":
+		switch msg.String() {
+		case "c":
+			if m.readOnly {
+				m.refuseEdit()
+				break
+			}
+			m.pendingOp, m.count = "gc", count
+		case "ctrl+g":
+			m.showWordCount(0, len(m.content)-1)
+		case "g":
+			if given > 0 {
+				m.goToLine(given)
+			} else {
+				m.applyMotion("gg")
+			}
+		default:
+			return m.handleNormalMode(msg)
+		}
+	case "gc":
+		if msg.String() == "c" {
+			m.toggleComment(m.cursorY, min(m.cursorY+count, len(m.content))-1)
+		}
+	case "d":
+		switch msg.String() {
+		case "d":
+			m.deleteLines(count)
+		case "i", "a":
+			m.pendingOp = "d" + msg.String()
+		default:
+			m.deleteMotion(msg.String(), count)
+		}
+	case "c":
+		switch msg.String() {
+		case "c":
+			m.changeLine()
+		case "i", "a":
+			m.pendingOp = "c" + msg.String()
+		}
+	case "di", "da", "ci", "ca":
+		m.operateOnObject(op, msg.String())
+	case "z":
+		switch msg.String() {
+		case "a":
+			m.toggleFold()
+		case "z":
+			m.centerCursorLine()
+		case "t":
+			m.offsetY = m.cursorY
+			m.adjustOffset()
+		case "b":
+			m.offsetY = m.topForRows(m.cursorY, m.height)
+			m.adjustOffset()
+		}
+	case "Z":
+		switch msg.String() {
+		case "Z":
+			if m.writeChangesAndQuit("", false) {
+				return m, tea.Sequence(tea.ClearScreen, tea.Quit)
+			}
+		case "Q":
+			if m.confirmQuit(true) {
+				return m, tea.Sequence(tea.ClearScreen, tea.Quit)
+			}
+		}
+	case "r":
+		if len(msg.Runes) == 1 {
+			m.replaceChar(msg.Runes[0])
+		}
+	case ">", "<":
+		if msg.String() == op {
+			m.shiftLines(m.cursorY, min(m.cursorY+count, len(m.content))-1, op == ">")
+		}
+	case "\"":
+		if len(msg.Runes) == 1 {
+			m.selectRegister(msg.Runes[0])
+		}
+	case "q":
+		if len(msg.Runes) == 1 {
+			m.startRecording(msg.Runes[0])
+		}
+	case "@":
+		if len(msg.Runes) == 1 {
+			return m.replayMacro(msg.Runes[0], count)
+		}
+	case "m":
+		if len(msg.Runes) == 1 {
+			m.setMark(msg.Runes[0])
+		}
+	case "`":
+		if len(msg.Runes) == 1 {
+			m.jumpToMark(msg.Runes[0])
+		}
 	}
 	return m, nil
 }
 
+// enterInsertMode switches to insert mode, starting an undo action so the
+// whole insert session undoes as one.
+func (m *model) enterInsertMode() {
+	m.mode = insertMode
+	m.statusMsg = "Insert mode"
+	m.beginUndo()
+}
+
+// exitInsertMode returns to normal mode. An insert session that changed
+// anything counts as a new change like any other edit.
+func (m *model) exitInsertMode() {
+	m.mode = normalMode
+	m.statusMsg = "Normal mode"
+	if m.editChanged() {
+		m.redoStack = nil
+		m.changeTick++
+	}
+}
+
+// openLine inserts a line at index y, indented like the cursor line when
+// auto-indent is on, and starts inserting on it.
+func (m *model) openLine(y int) {
+	m.enterInsertMode() // Snapshot first so the new line undoes with the insert
+	newLine := []rune{}
+	if m.autoIndent {
+		line := m.content[m.cursorY]
+		newLine = append(newLine, line[:firstNonBlank(line)]...)
+	}
+	m.changeLines(y, y)
+	m.content = slices.Insert(m.content, y, newLine)
+	m.shiftLineRefs(y, 1)
+	m.cursorY = y
+	m.cursorX = len(newLine)
+	m.modified = true
+	m.adjustOffset()
+}
+
 func (m model) handleInsertMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if key := msg.String(); key != "ctrl+n" && key != "ctrl+p" {
+		m.completions = nil // Any other key accepts the completion
+	}
 	switch msg.String() {
+	case "ctrl+n", "ctrl+p":
+		m.complete(msg.String() == "ctrl+n")
 	case "esc":
-		m.mode = normalMode
-		m.statusMsg = "Normal mode"
+		m.exitInsertMode()
 		if m.cursorX > 0 {
 			m.cursorX--
 		}
 	case "enter":
-		m.saveAction() // Save current state for undo
-		newLine := append([]rune{}, m.content[m.cursorY][m.cursorX:]...)
-		m.content[m.cursorY] = m.content[m.cursorY][:m.cursorX]
+		line := m.content[m.cursorY]
+		rest := line[m.cursorX:]
+		var indent []rune
+		if m.autoIndent {
+			// Carry the whole indentation over, even when splitting inside it
+			indent = line[:firstNonBlank(line)]
+			rest = rest[firstNonBlank(rest):]
+		}
+		newLine := append(append([]rune{}, indent...), rest...)
+		m.changeLines(m.cursorY, m.cursorY+1)
+		m.content[m.cursorY] = line[:m.cursorX]
 		m.content = append(m.content[:m.cursorY+1], append([][]rune{newLine}, m.content[m.cursorY+1:]...)...)
+		m.shiftLineRefs(m.cursorY+1, 1)
 		m.cursorY++
-		m.cursorX = 0
+		m.cursorX = len(indent)
 		m.modified = true
 	case "backspace":
+		if m.autoPairs && m.deletePair() {
+			break
+		}
 		if m.cursorX > 0 {
+			m.changeLines(m.cursorY, m.cursorY+1)
 			m.content[m.cursorY] = append(m.content[m.cursorY][:m.cursorX-1], m.content[m.cursorY][m.cursorX:]...)
 			m.cursorX--
 			m.modified = true
 		} else if m.cursorY > 0 {
 			m.cursorY--
 			m.cursorX = len(m.content[m.cursorY])
+			m.changeLines(m.cursorY, m.cursorY+2)
 			m.content[m.cursorY] = append(m.content[m.cursorY], m.content[m.cursorY+1]...)
 			m.content = append(m.content[:m.cursorY+1], m.content[m.cursorY+2:]...)
+			m.shiftLineRefs(m.cursorY+1, -1)
 			m.modified = true
 		}
 	case "tab":
-		for i := 0; i < m.tabSize; i++ {
-			m.content[m.cursorY] = append(m.content[m.cursorY][:m.cursorX], append([]rune{' '}, m.content[m.cursorY][m.cursorX:]...)...)
-			m.cursorX++
-		}
+		indent := m.indentUnit()
+		m.changeLines(m.cursorY, m.cursorY+1)
+		m.content[m.cursorY] = slices.Insert(m.content[m.cursorY], m.cursorX, indent...)
+		m.cursorX += len(indent)
 		m.modified = true
 	default:
+		if len(msg.Runes) == 1 && m.autoPairs && m.typePair(msg.Runes[0]) {
+			break
+		}
 		if len(msg.Runes) == 1 {
-			m.saveAction() // Save current state for undo
+			m.changeLines(m.cursorY, m.cursorY+1)
 			m.content[m.cursorY] = append(m.content[m.cursorY][:m.cursorX], append([]rune{msg.Runes[0]}, m.content[m.cursorY][m.cursorX:]...)...)
 			m.cursorX++
 			m.modified = true
@@ -288,33 +689,80 @@ func (m model) handleInsertMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (m model) handleSearchMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "esc":
+		m.restoreSearchOrigin()
+		m.searchTerm = m.searchPrev
 		m.mode = normalMode
 		m.statusMsg = "Normal mode"
 	case "enter":
+		m.restoreSearchOrigin()
+		m.pushJump()
 		m.findNext()
 		m.mode = normalMode
+		if n := len(m.searchHistory); m.searchTerm != "" && (n == 0 || m.searchHistory[n-1] != m.searchTerm) {
+			m.searchHistory = append(m.searchHistory, m.searchTerm)
+		}
+	case "up":
+		if m.searchHistoryIndex > 0 {
+			m.searchHistoryIndex--
+			m.searchTerm = m.searchHistory[m.searchHistoryIndex]
+			m.searchIncremental()
+		}
+	case "down":
+		if m.searchHistoryIndex < len(m.searchHistory) {
+			m.searchHistoryIndex++
+			m.searchTerm = ""
+			if m.searchHistoryIndex < len(m.searchHistory) {
+				m.searchTerm = m.searchHistory[m.searchHistoryIndex]
+			}
+			m.searchIncremental()
+		}
 	case "backspace":
 		if len(m.searchTerm) > 0 {
 			m.searchTerm = m.searchTerm[:len(m.searchTerm)-1]
-			m.statusMsg = "/" + m.searchTerm
+			m.searchIncremental()
 		}
 	default:
 		if len(msg.Runes) == 1 {
 			m.searchTerm += string(msg.Runes[0])
-			m.statusMsg = "/" + m.searchTerm
+			m.searchIncremental()
 		}
 	}
 	return m, nil
 }
 
+// startSearch enters search mode, remembering the cursor and the previous
+// pattern so that cancelling restores both.
+func (m *model) startSearch() {
+	m.mode = searchMode
+	m.statusMsg = "/"
+	m.searchPrev = m.searchTerm
+	m.searchTerm = ""
+	m.searchHistoryIndex = len(m.searchHistory)
+	m.searchOrigin = viewPos{m.cursorX, m.cursorY, m.offsetX, m.offsetY}
+}
+
+// searchIncremental moves the cursor to the first match of the term typed so
+// far, counting from where the search started.
+func (m *model) searchIncremental() {
+	m.restoreSearchOrigin()
+	if m.searchTerm != "" {
+		m.findNext()
+	}
+	m.statusMsg = "/" + m.searchTerm
+}
+
+func (m *model) restoreSearchOrigin() {
+	o := m.searchOrigin
+	m.cursorX, m.cursorY, m.offsetX, m.offsetY = o.cursorX, o.cursorY, o.offsetX, o.offsetY
+}
+
 func (m model) handleReplaceMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "esc":
 		m.mode = normalMode
 		m.statusMsg = "Normal mode"
 	case "enter":
-		m.replaceAll()
-		m.mode = normalMode
+		m.startReplace()
 	case "backspace":
 		if len(m.replaceTerm) > 0 {
 			m.replaceTerm = m.replaceTerm[:len(m.replaceTerm)-1]
@@ -329,9 +777,41 @@ func (m model) handleReplaceMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// handleConfirmMode answers the "replace with ...?" question asked at each
+// match during a replace.
+func (m model) handleConfirmMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y":
+		m.replaceCurrentMatch()
+	case "n":
+		m.nextReplaceMatch(m.cursorY, m.replaceMatchEnd)
+	case "a":
+		for m.mode == confirmMode {
+			m.replaceCurrentMatch()
+		}
+	case "q", "esc":
+		m.finishReplace()
+	}
+	return m, nil
+}
+
 func (m *model) moveCursor(dx, dy int) {
+	if m.wrap && dx == 0 {
+		m.moveRows(dy) // Move through the rows of wrapped lines
+		return
+	}
 	m.cursorX += dx
-	m.cursorY += dy
+	// Step over folded lines one visible line at a time
+	for ; dy > 0 && m.cursorY < len(m.content)-1; dy-- {
+		if next := m.nextVisibleLine(m.cursorY); next < len(m.content) {
+			m.cursorY = next
+		} else {
+			break
+		}
+	}
+	for ; dy < 0 && m.cursorY > 0; dy++ {
+		m.cursorY = m.prevVisibleLine(m.cursorY)
+	}
 
 	if m.cursorY < 0 {
 		m.cursorY = 0
@@ -348,87 +828,775 @@ func (m *model) moveCursor(dx, dy int) {
 	m.adjustOffset()
 }
 
+// pasteLines inserts the lines of text count times as new lines at line at,
+// moving the cursor onto the first of them.
+func (m *model) pasteLines(at int, text string, count int) {
+	var lines [][]rune
+	for range count {
+		for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+			lines = append(lines, []rune(line))
+		}
+	}
+	m.changeLines(at, at)
+	m.content = slices.Insert(m.content, at, lines...)
+	m.shiftLineRefs(at, len(lines))
+	m.cursorY = at
+	m.cursorX = firstNonBlank(lines[0])
+	m.modified = true
+}
+
+// pasteChars inserts text before the cursor, splitting the line where the
+// text holds line breaks. The cursor ends on the last pasted rune, or at the
+// start of the text when it spans lines.
+func (m *model) pasteChars(text string) {
+	if len(m.content) == 0 {
+		m.content = [][]rune{{}}
+	}
+	pieces := strings.Split(text, "\n")
+	line := m.content[m.cursorY]
+	x := min(m.cursorX, len(line))
+	after := slices.Clone(line[x:])
+	lines := make([][]rune, len(pieces))
+	for i, piece := range pieces {
+		lines[i] = []rune(piece)
+	}
+	lines[0] = append(slices.Clone(line[:x]), lines[0]...)
+	last := len(lines) - 1
+	lines[last] = append(lines[last], after...)
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content = slices.Replace(m.content, m.cursorY, m.cursorY+1, lines...)
+	m.shiftLineRefs(m.cursorY+1, last)
+	if last == 0 {
+		m.cursorX = x + len([]rune(text)) - 1
+	} else {
+		m.cursorX = x
+	}
+	m.modified = true
+}
+
+// deleteLines removes n lines starting at the cursor, or as many as remain,
+// keeping them in the clipboard.
+func (m *model) deleteLines(n int) {
+	m.saveAction() // Save current state for undo
+	end := min(m.cursorY+n, len(m.content))
+	var text strings.Builder
+	for _, line := range m.content[m.cursorY:end] {
+		text.WriteString(string(line) + "\n")
+	}
+	m.yankText(text.String(), true)
+	m.changeLines(m.cursorY, end)
+	m.content = append(m.content[:m.cursorY], m.content[end:]...)
+	m.shiftLineRefs(m.cursorY, m.cursorY-end)
+	if len(m.content) == 0 {
+		m.content = [][]rune{{}}
+	}
+	if m.cursorY >= len(m.content) {
+		m.cursorY = len(m.content) - 1
+	}
+	m.cursorX = firstNonBlank(m.content[m.cursorY])
+	m.modified = true
+	m.adjustOffset()
+}
+
+// deleteChars removes up to n runes from the cursor on the current line.
+func (m *model) deleteChars(n int) {
+	line := m.content[m.cursorY]
+	if m.cursorX >= len(line) {
+		return
+	}
+	m.saveAction() // Save current state for undo
+	end := min(m.cursorX+n, len(line))
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = append(line[:m.cursorX], line[end:]...)
+	m.modified = true
+}
+
+// repeat runs edit n times as a single undo action.
+func (m *model) repeat(n int, edit func()) {
+	if !m.undoHeld {
+		m.flushUndo() // Keep the edits before apart
+	}
+	held := m.undoHeld
+	m.undoHeld = true
+	for range n {
+		edit()
+	}
+	m.undoHeld = held
+}
+
+// deleteMotion removes the text between the cursor and where the motion key
+// would move it count times on the same line, keeping it in the clipboard.
+// Like the motions themselves it never crosses into another line.
+func (m *model) deleteMotion(key string, count int) {
+	line := m.content[m.cursorY]
+	start, end := m.cursorX, m.cursorX
+	for range count {
+		switch key {
+		case "w":
+			end = nextWordStart(line, end)
+		case "e":
+			if e := wordEnd(line, max(end-1, m.cursorX)); e >= 0 {
+				end = e + 1
+			} else {
+				end = len(line)
+			}
+		case "b":
+			start = max(prevWordStart(line, start), 0)
+		case "$":
+			end = len(line)
+		case "0":
+			start = 0
+		default:
+			return
+		}
+	}
+	start, end = min(start, len(line)), min(end, len(line))
+	if start == end {
+		return
+	}
+
+	m.saveAction() // Save current state for undo
+	m.yankText(string(line[start:end]), false)
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = append(line[:start], line[end:]...)
+	m.cursorX = start
+	m.modified = true
+}
+
+// changeLine clears the current line, keeping its indentation when
+// auto-indent is on, and starts inserting. The deletion and the insert undo
+// together.
+func (m *model) changeLine() {
+	m.enterInsertMode()
+	line := m.content[m.cursorY]
+	keep := 0
+	if m.autoIndent {
+		keep = firstNonBlank(line)
+	}
+	m.yankText(string(line)+"\n", true)
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = line[:keep]
+	m.cursorX = keep
+	m.modified = true
+	m.adjustOffset()
+}
+
+// changeToEnd deletes from the cursor to the end of the line and starts
+// inserting there.
+func (m *model) changeToEnd() {
+	m.enterInsertMode()
+	line := m.content[m.cursorY]
+	m.cursorX = min(m.cursorX, len(line))
+	m.yankText(string(line[m.cursorX:]), false)
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = line[:m.cursorX]
+	m.modified = true
+}
+
+// joinLines appends the next line to the current one, separated by a single
+// space in place of the next line's indentation.
+func (m *model) joinLines() {
+	if m.cursorY >= len(m.content)-1 {
+		return
+	}
+	m.saveAction() // Save current state for undo
+	m.changeLines(m.cursorY, m.cursorY+2)
+
+	line := m.content[m.cursorY]
+	next := m.content[m.cursorY+1]
+	next = next[firstNonBlank(next):]
+	joinAt := len(line)
+	if len(line) > 0 && len(next) > 0 && !unicode.IsSpace(line[len(line)-1]) {
+		line = append(line, ' ')
+	}
+	m.content[m.cursorY] = append(line, next...)
+	m.content = append(m.content[:m.cursorY+1], m.content[m.cursorY+2:]...)
+	m.shiftLineRefs(m.cursorY+1, -1)
+	m.cursorX = joinAt
+	m.modified = true
+	m.adjustOffset()
+}
+
+// replaceChar overwrites the rune under the cursor with r.
+func (m *model) replaceChar(r rune) {
+	line := m.content[m.cursorY]
+	if m.cursorX >= len(line) {
+		return
+	}
+	m.saveAction() // Save current state for undo
+	m.changeLines(m.cursorY, m.cursorY+1)
+	line[m.cursorX] = r
+	m.modified = true
+}
+
+// addToNumber adds delta to the integer under or after the cursor on the
+// current line, keeping any zero padding, and leaves the cursor on its last
+// digit.
+func (m *model) addToNumber(delta int) {
+	line := m.content[m.cursorY]
+	start := min(m.cursorX, len(line))
+	for start < len(line) && !unicode.IsDigit(line[start]) {
+		start++
+	}
+	if start == len(line) {
+		m.statusMsg = "No number on this line"
+		return
+	}
+	for start > 0 && unicode.IsDigit(line[start-1]) {
+		start--
+	}
+	end := start
+	for end < len(line) && unicode.IsDigit(line[end]) {
+		end++
+	}
+	digits := line[start:end]
+	n, err := strconv.ParseInt(string(digits), 10, 64)
+	if err != nil {
+		m.statusMsg = "Number too large"
+		return
+	}
+	if start > 0 && line[start-1] == '-' {
+		start--
+		n = -n
+	}
+
+	n += int64(delta)
+	abs, sign := n, ""
+	if n < 0 {
+		abs, sign = -n, "-"
+	}
+	width := 0
+	if len(digits) > 1 && digits[0] == '0' {
+		width = len(digits) // A zero-padded number keeps its width
+	}
+	text := []rune(fmt.Sprintf("%s%0*d", sign, width, abs))
+
+	m.saveAction() // Save current state for undo
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = slices.Replace(line, start, end, text...)
+	m.cursorX = start + len(text) - 1
+	m.modified = true
+	m.adjustOffset()
+}
+
+// toggleCase flips the case of the rune under the cursor and moves right.
+func (m *model) toggleCase() {
+	line := m.content[m.cursorY]
+	if m.cursorX >= len(line) {
+		return
+	}
+	r := line[m.cursorX]
+	if toggled := toggleRuneCase(r); toggled != r {
+		m.saveAction() // Save current state for undo
+		m.changeLines(m.cursorY, m.cursorY+1)
+		line[m.cursorX] = toggled
+		m.modified = true
+	}
+	m.moveCursor(1, 0)
+}
+
+// indentUnit returns what one level of indentation inserts: a tab, or
+// tabSize spaces with expandtab.
+func (m model) indentUnit() []rune {
+	if m.expandTab {
+		return []rune(strings.Repeat(" ", m.tabSize))
+	}
+	return []rune{'\t'}
+}
+
+// shiftLines indents (or dedents) lines startY through endY by one level as
+// a single undoable action. Dedenting removes a leading tab or up to tabSize
+// leading spaces.
+func (m *model) shiftLines(startY, endY int, right bool) {
+	m.saveAction() // Save current state for undo
+	m.changeLines(startY, endY+1)
+	for y := startY; y <= endY; y++ {
+		line := m.content[y]
+		if right {
+			if len(line) > 0 {
+				m.content[y] = append(m.indentUnit(), line...)
+			}
+			continue
+		}
+		n := 0
+		if len(line) > 0 && line[0] == '\t' {
+			n = 1
+		} else {
+			for n < len(line) && n < m.tabSize && line[n] == ' ' {
+				n++
+			}
+		}
+		m.content[y] = line[n:]
+	}
+	m.cursorY = startY
+	m.cursorX = firstNonBlank(m.content[startY])
+	m.modified = true
+	m.adjustOffset()
+}
+
+// deleteToEnd removes the text from the cursor to the end of the line,
+// keeping it in the clipboard.
+func (m *model) deleteToEnd() {
+	line := m.content[m.cursorY]
+	if m.cursorX >= len(line) {
+		return
+	}
+	m.saveAction() // Save current state for undo
+	m.yankText(string(line[m.cursorX:]), false)
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = line[:m.cursorX]
+	m.modified = true
+}
+
+// wordForward moves the cursor to the start of the next word, continuing on
+// the following line when the current one has no word left.
+func (m *model) wordForward() {
+	line := m.content[m.cursorY]
+	if x := nextWordStart(line, m.cursorX); x < len(line) {
+		m.cursorX = x
+	} else if m.cursorY < len(m.content)-1 {
+		m.cursorY++
+		m.cursorX = firstNonBlank(m.content[m.cursorY])
+	}
+	m.adjustOffset()
+}
+
+// wordBackward moves the cursor to the start of the previous word, moving to
+// the last word of the line above when there is none before the cursor.
+func (m *model) wordBackward() {
+	if x := prevWordStart(m.content[m.cursorY], m.cursorX); x >= 0 {
+		m.cursorX = x
+	} else if m.cursorY > 0 {
+		m.cursorY--
+		line := m.content[m.cursorY]
+		m.cursorX = max(prevWordStart(line, len(line)), 0)
+	} else {
+		m.cursorX = 0
+	}
+	m.adjustOffset()
+}
+
+// wordEndForward moves the cursor to the end of the current or next word,
+// searching the following lines when the current one has no word left.
+func (m *model) wordEndForward() {
+	if x := wordEnd(m.content[m.cursorY], m.cursorX); x >= 0 {
+		m.cursorX = x
+	} else {
+		for y := m.cursorY + 1; y < len(m.content); y++ {
+			if x := wordEnd(m.content[y], -1); x >= 0 {
+				m.cursorY, m.cursorX = y, x
+				break
+			}
+		}
+	}
+	m.adjustOffset()
+}
+
+// goToLine moves the cursor to the 1-indexed line n, clamped to the buffer,
+// and scrolls so that line is centered on screen.
+func (m *model) goToLine(n int) {
+	m.pushJump()
+	m.cursorY = max(0, min(n-1, len(m.content)-1))
+	m.cursorX = firstNonBlank(m.content[m.cursorY])
+	m.centerCursorLine()
+}
+
+// centerCursorLine scrolls vertically so the cursor line is in the middle of
+// the screen.
+func (m *model) centerCursorLine() {
+	m.offsetY = m.topForRows(m.cursorY, m.height/2+1)
+	m.adjustOffset()
+}
+
+// jumpToScreenLine moves the cursor to the first non-blank of the top line
+// on screen for H, the middle one for M or the bottom one for L, without
+// scrolling.
+func (m *model) jumpToScreenLine(key string) {
+	m.pushJump()
+	var lines []int
+	for y := m.offsetY; y < m.lineAfterRows(m.offsetY, m.height) && y < len(m.content); y = m.nextVisibleLine(y) {
+		lines = append(lines, y)
+	}
+	if len(lines) == 0 {
+		lines = []int{m.offsetY} // A line taller than the screen
+	}
+	switch key {
+	case "H":
+		m.cursorY = lines[0]
+	case "M":
+		m.cursorY = lines[(len(lines)-1)/2]
+	case "L":
+		m.cursorY = lines[len(lines)-1]
+	}
+	m.cursorX = firstNonBlank(m.content[m.cursorY])
+	m.adjustOffset()
+}
+
+// scrollHalfPage moves the view and the cursor half a screen down or up, so
+// the cursor stays on the same row. The view stops once the last line is on
+// screen, or the first, and the cursor goes on to the end of the buffer.
+func (m *model) scrollHalfPage(down bool) {
+	for range max(m.height/2, 1) {
+		if down {
+			next := m.nextVisibleLine(m.cursorY)
+			if next >= len(m.content) {
+				break
+			}
+			m.cursorY = next
+			if m.lineAfterRows(m.offsetY, m.height) < len(m.content) {
+				m.offsetY = m.nextVisibleLine(m.offsetY)
+			}
+		} else {
+			if m.cursorY == 0 {
+				break
+			}
+			m.cursorY = m.prevVisibleLine(m.cursorY)
+			if m.offsetY > 0 {
+				m.offsetY = m.prevVisibleLine(m.offsetY)
+			}
+		}
+	}
+	m.cursorX = min(m.cursorX, len(m.content[m.cursorY]))
+	m.adjustOffset()
+}
+
+// topForRows returns the highest line from which the lines up to and
+// including y fit in the given number of rows. Line y itself is always
+// included.
+func (m model) topForRows(y, rows int) int {
+	top, used := y, len(m.rowStarts(y))
+	for top > 0 {
+		prev := m.prevVisibleLine(top)
+		if used += len(m.rowStarts(prev)); used > rows {
+			break
+		}
+		top = prev
+	}
+	return top
+}
+
 func (m *model) adjustOffset() {
+	m.openFoldsAt(m.cursorY) // Jumping into a fold opens it
 	if m.cursorY < m.offsetY {
 		m.offsetY = m.cursorY
-	} else if m.cursorY >= m.offsetY+m.height {
-		m.offsetY = m.cursorY - m.height + 1
+	} else if m.cursorY >= m.lineAfterRows(m.offsetY, m.height) {
+		m.offsetY = m.topForRows(m.cursorY, m.height)
+	}
+
+	if m.wrap {
+		m.offsetX = 0 // Wrapped lines never scroll sideways
+		return
+	}
+
+	line := m.content[m.cursorY]
+	col := displayColumn(line, m.cursorX, m.tabSize)
+	width := 1 // Keep both halves of a wide rune in view
+	if m.cursorX < len(line) && line[m.cursorX] != '\t' {
+		width = runeWidth(line[m.cursorX])
+	}
+	if col < m.offsetX {
+		m.offsetX = col
+	} else if col+width > m.offsetX+m.textWidth() {
+		m.offsetX = col + width - m.textWidth()
 	}
 }
 
+// textWidth returns the number of columns available for content once the
+// line-number gutter is drawn.
+func (m model) textWidth() int {
+	width := m.width - m.gutter()
+	if m.scrollbar {
+		width--
+	}
+	return max(width, 1)
+}
+
+// gutter returns the width of the line-number gutter: as many columns as the
+// number of the last line has digits, and a space before the text. It is
+// hidden when neither absolute nor relative numbers are shown.
+func (m model) gutter() int {
+	if !m.number && !m.relativeNumbers {
+		return 0
+	}
+	return len(strconv.Itoa(max(len(m.content), 1))) + 1
+}
+
+// findNext moves the cursor to the next match of the search term, wrapping
+// around to the top of the file when searchWrap is set.
 func (m *model) findNext() {
-	startY, startX := m.cursorY, m.cursorX+1
-	for y := startY; y < len(m.content); y++ {
-		x := strings.Index(string(m.content[y][startX:]), m.searchTerm)
-		if x != -1 {
+	re, ok := m.searchPattern()
+	if !ok {
+		return
+	}
+	for i := 0; i <= len(m.content); i++ {
+		y := m.cursorY + i
+		wrapped := y >= len(m.content)
+		if wrapped {
+			if !m.searchWrap {
+				break
+			}
+			y -= len(m.content)
+		}
+		for _, match := range searchMatches(m.content[y], re) {
+			if i == 0 && match[0] <= m.cursorX {
+				continue
+			}
 			m.cursorY = y
-			m.cursorX = startX + x
+			m.cursorX = match[0]
+			m.statusMsg = "/" + m.searchTerm
+			if wrapped {
+				m.statusMsg = "search hit BOTTOM, continuing at TOP"
+			}
 			m.adjustOffset()
 			return
 		}
-		startX = 0
 	}
 	m.statusMsg = "Pattern not found: " + m.searchTerm
 }
 
+// findPrevious moves the cursor to the previous match of the search term,
+// wrapping around to the bottom of the file when searchWrap is set.
 func (m *model) findPrevious() {
-	startY, startX := m.cursorY, m.cursorX-1
-	for y := startY; y >= 0; y-- {
-		if startX < 0 {
-			startX = len(m.content[y]) - 1
+	re, ok := m.searchPattern()
+	if !ok {
+		return
+	}
+	for i := 0; i <= len(m.content); i++ {
+		y := m.cursorY - i
+		wrapped := y < 0
+		if wrapped {
+			if !m.searchWrap {
+				break
+			}
+			y += len(m.content)
 		}
-		x := strings.LastIndex(string(m.content[y][:startX+1]), m.searchTerm)
-		if x != -1 {
+		matches := searchMatches(m.content[y], re)
+		for j := len(matches) - 1; j >= 0; j-- {
+			if i == 0 && matches[j][0] >= m.cursorX {
+				continue
+			}
 			m.cursorY = y
-			m.cursorX = x
+			m.cursorX = matches[j][0]
+			m.statusMsg = "?" + m.searchTerm
+			if wrapped {
+				m.statusMsg = "search hit TOP, continuing at BOTTOM"
+			}
 			m.adjustOffset()
 			return
 		}
-		startX = -1
 	}
 	m.statusMsg = "Pattern not found: " + m.searchTerm
 }
 
-func (m *model) replaceAll() {
-	count := 0
-	for y := range m.content {
-		line := string(m.content[y])
-		newLine := strings.ReplaceAll(line, m.searchTerm, m.replaceTerm)
-		if newLine != line {
-			m.content[y] = []rune(newLine)
-			count += strings.Count(line, m.searchTerm)
-			m.modified = true
+// searchWordUnderCursor searches for the next whole-word match of the word
+// under the cursor, or the previous one when forward is false. It does
+// nothing when the cursor is not on a word.
+func (m *model) searchWordUnderCursor(forward bool) {
+	line := m.content[m.cursorY]
+	if m.cursorX >= len(line) || !isWordChar(line[m.cursorX]) {
+		return
+	}
+	start, end := m.cursorX, m.cursorX+1
+	for start > 0 && isWordChar(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordChar(line[end]) {
+		end++
+	}
+	m.searchTerm = `\<` + string(line[start:end]) + `\>`
+	if n := len(m.searchHistory); n == 0 || m.searchHistory[n-1] != m.searchTerm {
+		m.searchHistory = append(m.searchHistory, m.searchTerm)
+	}
+	m.pushJump()
+	m.cursorX = start // Past this match either way
+	if forward {
+		m.findNext()
+	} else {
+		m.findPrevious()
+	}
+}
+
+// searchPattern compiles the search term, reporting an empty or invalid
+// pattern in the status bar. Searching again undoes :noh.
+func (m *model) searchPattern() (*regexp.Regexp, bool) {
+	m.noHighlight = false
+	if m.searchTerm == "" {
+		m.statusMsg = "No previous search pattern"
+		return nil, false
+	}
+	re, err := m.compileSearch()
+	if err != nil {
+		m.statusMsg = "Invalid pattern: " + err.Error()
+		return nil, false
+	}
+	return re, true
+}
+
+// compileSearch builds the regular expression for the search term, quoting
+// it unless regex search is enabled. Either way \< and \> match the start
+// and end of a word, as in the terms * and # search for.
+func (m model) compileSearch() (*regexp.Regexp, error) {
+	pattern := m.searchTerm
+	if m.searchRegex {
+		pattern = regexWordBounds.Replace(pattern)
+	} else {
+		pattern = quotedWordBounds.Replace(regexp.QuoteMeta(pattern))
+	}
+	if m.searchIgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// regexWordBounds turns \< and \> in a regex search term into word
+// boundaries, and quotedWordBounds does the same once a plain term is quoted.
+// Escaped backslashes are kept as they are.
+var (
+	regexWordBounds  = strings.NewReplacer(`\\`, `\\`, `\<`, `\b`, `\>`, `\b`)
+	quotedWordBounds = strings.NewReplacer(`\\\\`, `\\\\`, `\\<`, `\b`, `\\>`, `\b`)
+)
+
+// startReplace walks through every match of the search term from the top of
+// the file, asking whether to replace each one.
+func (m *model) startReplace() {
+	m.mode = normalMode
+	re, ok := m.searchPattern()
+	if !ok {
+		return
+	}
+	m.saveAction() // The whole replace is a single undo step
+	m.replacePattern = re
+	m.replaceCount = 0
+	m.mode = confirmMode
+	m.nextReplaceMatch(0, 0)
+}
+
+// nextReplaceMatch moves to the first match at or after column x of line y,
+// finishing the replace when none are left.
+func (m *model) nextReplaceMatch(y, x int) {
+	for ; y < len(m.content); y++ {
+		for _, match := range searchMatches(m.content[y], m.replacePattern) {
+			if match[0] >= x {
+				m.cursorY, m.cursorX = y, match[0]
+				m.replaceMatchEnd = match[1]
+				m.statusMsg = fmt.Sprintf("replace with %s (y/n/a/q)?", m.replaceTerm)
+				m.adjustOffset()
+				return
+			}
 		}
+		x = 0
 	}
-	m.statusMsg = fmt.Sprintf("Replaced %d occurrences", count)
+	m.finishReplace()
 }
 
-func (m *model) saveFile() {
-	content := ""
-	for _, line := range m.content {
-		content += string(line) + "\n"
+// replaceCurrentMatch replaces the match under the cursor and moves on to the
+// next one.
+func (m *model) replaceCurrentMatch() {
+	line := m.content[m.cursorY]
+	replacement := m.replaceTerm
+	if m.searchRegex {
+		replacement = m.replacePattern.ReplaceAllString(string(line[m.cursorX:m.replaceMatchEnd]), m.replaceTerm)
 	}
-	if m.filename != "" {
-		err := os.WriteFile(m.filename, []byte(content), 0644)
-		if err != nil {
-			m.statusMsg = "Error saving file: " + err.Error()
-		} else {
-			m.statusMsg = "File saved successfully"
-			m.modified = false
+	newText := []rune(replacement)
+
+	newLine := append([]rune{}, line[:m.cursorX]...)
+	newLine = append(newLine, newText...)
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = append(newLine, line[m.replaceMatchEnd:]...)
+	m.replaceCount++
+	m.modified = true
+	m.nextReplaceMatch(m.cursorY, m.cursorX+len(newText))
+}
+
+func (m *model) finishReplace() {
+	m.mode = normalMode
+	m.statusMsg = fmt.Sprintf("Replaced %d occurrences", m.replaceCount)
+}
+
+// saveFile writes the buffer to its file, asking for a filename first when
+// the buffer doesn't have one yet.
+func (m *model) saveFile() bool {
+	if m.filename == "" {
+		m.promptSaveAs(nil)
+		return false
+	}
+	return m.writeFile(m.filename)
+}
+
+// text returns the buffer as it is written to disk. The last line only gets
+// a newline if the file had one, so a file without one, or an empty file,
+// is written back as it was read.
+func (m buffer) text() string {
+	var content strings.Builder
+	for i, line := range m.content {
+		content.WriteString(string(line))
+		if i < len(m.content)-1 || m.finalNewline {
+			content.WriteByte('\n')
 		}
-	} else {
-		err := os.WriteFile("samples/output.txt", []byte(content), 0644)
-		if err != nil {
-			m.statusMsg = "Error saving file: " + err.Error()
-		} else {
-			m.statusMsg = "File saved successfully"
-			m.modified = false
+	}
+	return content.String()
+}
+
+// writeFile writes the buffer to filename and reports whether it succeeded.
+func (m *model) writeFile(filename string) bool {
+	// Keep the file as it was before this session first overwrites it
+	backup := ""
+	if m.backup && !m.wroteFile && filename == m.filename {
+		var err error
+		if backup, err = writeBackup(filename); err != nil {
+			m.statusMsg = "Error writing backup: " + err.Error()
+			return false
 		}
 	}
+
+	var formatErr error
+	if m.gofmt && filepath.Ext(filename) == ".go" {
+		formatErr = m.formatGo()
+	}
+
+	err := os.WriteFile(filename, []byte(m.text()), 0644)
+	if err != nil {
+		m.statusMsg = "Error saving file: " + err.Error()
+		return false
+	}
+	m.statusMsg = "File saved successfully"
+	if backup != "" {
+		m.statusMsg += ", backup written to " + backup
+	}
+	if formatErr != nil {
+		m.statusMsg += ", not formatted: " + formatErr.Error()
+	}
+	if filename == m.filename {
+		m.wroteFile = true
+		m.noteModTime()
+	}
+	m.modified = false
+	return true
 }
 
+// writeBackup copies filename to filename~ and returns the copy's path, or
+// "" if there is no file to back up yet.
+func writeBackup(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	path := filename + "~"
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// statusStyle colors the status bar.
+var statusStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("15")).
+	Background(lipgloss.Color("57"))
+
 func (m model) View() string {
+	// Room for every cell with a few style changes, so the builder rarely
+	// has to grow
 	var s strings.Builder
+	s.Grow((m.width + 64) * (m.rows + 1))
 
 	// Ensure content is never empty
 	if len(m.content) == 0 {
@@ -443,48 +1611,36 @@ func (m model) View() string {
 		m.cursorX = len(m.content[m.cursorY])
 	}
 
-	// Content area
-	for i := 0; i < m.height; i++ {
-		lineNum := m.offsetY + i
-		if lineNum < len(m.content) {
-			line := m.content[lineNum]
-			lineStr := expandTabs(string(line), m.tabSize)
-
-			// Apply search highlighting
-			if m.searchTerm != "" {
-				lineStr = highlightSearch(lineStr, m.searchTerm)
-			}
+	// An invalid pattern is reported when searching; just skip highlighting
+	var searchRe *regexp.Regexp
+	showMatches := m.mode == searchMode || m.mode == confirmMode || m.hlsearch && !m.noHighlight
+	if m.searchTerm != "" && showMatches {
+		searchRe, _ = m.compileSearch()
+	}
 
-			if lineNum == m.cursorY && m.mode != normalMode {
-				cursorRune := '|'
-				if m.cursorX < len(lineStr) {
-					cursorRune = rune(lineStr[m.cursorX])
-				}
-				if m.cursorX < len(lineStr) {
-					lineStr = lineStr[:m.cursorX] + string(cursorRune) + lineStr[m.cursorX+1:]
-				} else {
-					lineStr += string(cursorRune)
-				}
-			}
-			s.WriteString(fmt.Sprintf("%4d %s\n", lineNum+1, lineStr))
+	// Content area
+	if m.mode == matchesMode {
+		m.renderMatches(&s)
+	} else if m.mode == finderMode {
+		m.renderFinder(&s)
+	} else if m.split {
+		other := m
+		other.buffer = m.buffers[m.splitBuffer]
+		if m.splitBelow {
+			m.renderPane(&s, true, searchRe)
+			s.WriteString(m.separator(m.filename) + "\n")
+			other.renderPane(&s, false, searchRe)
 		} else {
-			s.WriteString("~\n")
+			other.renderPane(&s, false, searchRe)
+			s.WriteString(m.separator(other.filename) + "\n")
+			m.renderPane(&s, true, searchRe)
 		}
+	} else {
+		m.renderPane(&s, true, searchRe)
 	}
 
 	// Status bar
-	statusStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("15")).
-		Background(lipgloss.Color("57"))
-
-	modeInfo := fmt.Sprintf("%s", m.mode)
-	fileInfo := fmt.Sprintf("%-20s", m.filename)
-	cursorInfo := fmt.Sprintf("(%d,%d)", m.cursorY+1, m.cursorX+1)
-	modifiedInfo := ""
-	if m.modified {
-		modifiedInfo = "[+]"
-	}
-	statusBar := statusStyle.Render(fmt.Sprintf("%s {%s} %s %s %s", modeInfo, m.statusMsg, fileInfo, cursorInfo, modifiedInfo))
+	statusBar := statusStyle.Render(m.statusLine())
 
 	s.WriteString(statusBar)
 
@@ -494,22 +1650,308 @@ func (m model) View() string {
 	return s.String()
 }
 
+// scrollPosition describes how far the focused pane is scrolled like vim's
+// ruler: "All" when the whole buffer fits, "Top" or "Bot" at either end, and
+// otherwise the percentage of lines above the screen.
+func (m model) scrollPosition() string {
+	above := m.offsetY
+	below := len(m.content) - m.lineAfterRows(m.offsetY, m.height)
+	switch {
+	case above == 0 && below <= 0:
+		return "All"
+	case above == 0:
+		return "Top"
+	case below <= 0:
+		return "Bot"
+	}
+	return strconv.Itoa(above*100/(above+below)) + "%"
+}
+
+// displayLineNumber returns the number shown in the gutter for lineNum: its
+// distance from the cursor line with relative numbers, or its 1-indexed line.
+// With relative numbers the cursor line shows its own number only when
+// number is set as well, and 0 otherwise.
+func (m model) displayLineNumber(lineNum int) int {
+	if m.relativeNumbers && (lineNum != m.cursorY || !m.number) {
+		return max(lineNum-m.cursorY, m.cursorY-lineNum)
+	}
+	return lineNum + 1
+}
+
+// renderPane draws the rows of a pane showing the buffer into s. Only the
+// focused pane shows the cursor and the selection.
+func (m model) renderPane(s *strings.Builder, focused bool, searchRe *regexp.Regexp) {
+	height := m.height
+	if !focused {
+		height = m.rows - 1 - m.height
+		m.mode = normalMode
+	}
+
+	// Every row ends with the scrollbar when it is shown
+	thumbFrom, thumbTo := m.scrollThumb(height)
+	row := 0
+	endRow := func(used int) {
+		if m.scrollbar {
+			s.WriteString(strings.Repeat(" ", max(0, m.textWidth()-used)))
+			if thumbFrom <= row && row < thumbTo {
+				s.WriteString(thumbStart + " " + styleReset)
+			} else {
+				s.WriteString(trackStart + " " + styleReset)
+			}
+		}
+		s.WriteByte('\n')
+		row++
+	}
+
+	lineNum := m.offsetY
+	for i := 0; i < height; i++ {
+		if lineNum >= len(m.content) {
+			s.WriteByte('~')
+			endRow(1)
+			continue
+		}
+		cursor := focused && lineNum == m.cursorY
+		m.writeGutter(s, lineNum, cursor)
+		if f := m.foldAt(lineNum); f >= 0 {
+			fold := m.renderFold(m.folds[f], cursor)
+			s.WriteString(fold)
+			endRow(lipgloss.Width(fold))
+			lineNum = m.folds[f].end + 1
+			continue
+		}
+		i += m.renderLine(s, lineNum, cursor, searchRe, height-i, endRow) - 1
+		lineNum++
+	}
+}
+
+// scrollThumb returns the rows from start up to end of the scrollbar that
+// show which part of the buffer is on a pane of the given height.
+func (m model) scrollThumb(height int) (start, end int) {
+	if !m.scrollbar {
+		return 0, 0
+	}
+	total := len(m.content)
+	visible := min(m.lineAfterRows(m.offsetY, height), total) - m.offsetY
+	start = m.offsetY * height / total
+	end = start + max(1, (visible*height+total-1)/total)
+	return start, min(end, height)
+}
+
+// writeGutter writes the line number of lineNum, or a blank gutter for the
+// further rows of a wrapped line when lineNum is negative.
+func (m model) writeGutter(s *strings.Builder, lineNum int, cursor bool) {
+	if m.gutter() == 0 {
+		return
+	}
+	if m.cursorLine && cursor {
+		s.WriteString(cursorLineBg)
+		defer s.WriteString(styleReset)
+	}
+	if lineNum < 0 {
+		s.WriteString(strings.Repeat(" ", m.gutter()))
+		return
+	}
+	writeLineNumber(s, m.displayLineNumber(lineNum), m.gutter())
+}
+
+// writeLineNumber writes a gutter width columns wide for line number n,
+// formatted like "%*d " without going through fmt.
+func writeLineNumber(s *strings.Builder, n, width int) {
+	var buf [20]byte
+	digits := strconv.AppendInt(buf[:0], int64(n), 10)
+	for i := len(digits); i < width-1; i++ {
+		s.WriteByte(' ')
+	}
+	s.Write(digits)
+	s.WriteByte(' ')
+}
+
+// renderLine writes the part of a content line visible from offsetX to s,
+// with search matches and the visual selection highlighted, and the cursor
+// drawn if it is on this line. With wrap set the whole line is written over
+// as many rows as it needs, up to maxRows; it returns the number of rows.
+// Each row is finished by endRow, given the number of columns written.
+func (m model) renderLine(s *strings.Builder, lineNum int, cursor bool, searchRe *regexp.Regexp, maxRows int, endRow func(used int)) int {
+	line := m.content[lineNum]
+
+	// Style runes before slicing so highlights starting left of the viewport
+	// are kept.
+	styles := make([]cellStyle, len(line))
+	if m.syntax {
+		for _, span := range highlightLine(line, filepath.Ext(m.filename)) {
+			for i := span.start; i < span.end; i++ {
+				styles[i] |= span.style
+			}
+		}
+	}
+	for _, match := range searchMatches(line, searchRe) {
+		style := styleSearch
+		if cursor && match[0] == m.cursorX {
+			style = styleCurrentMatch
+		}
+		for i := match[0]; i < match[1]; i++ {
+			styles[i] |= style
+		}
+	}
+	if m.cursorLine && cursor {
+		for i := range styles {
+			styles[i] |= styleCursorLine
+		}
+	}
+	if m.mode == visualMode {
+		if start, end, ok := m.selectedRange(lineNum); ok {
+			for i := start; i < end; i++ {
+				styles[i] |= styleSelect
+			}
+		}
+	}
+
+	// A block cursor in normal and visual mode, a thinner underline while
+	// typing
+	block := m.mode == normalMode || m.mode == visualMode
+	if cursor && m.cursorX < len(line) {
+		if block {
+			styles[m.cursorX] |= styleCursor
+		} else {
+			styles[m.cursorX] |= styleBar
+		}
+	}
+
+	cells, source := expandTabs(line, m.tabSize)
+	starts := []int{m.offsetX}
+	if m.wrap {
+		starts = wrapRows(cells, m.textWidth())
+	}
+	if m.list {
+		showWhitespace(cells, source, line)
+	}
+
+	// Linewise selections and the cursor line extend across the whole width
+	fill := ""
+	if m.mode == visualMode && m.selLinewise {
+		if _, _, ok := m.selectedRange(lineNum); ok {
+			fill = selectStart
+		}
+	}
+	if fill == "" && m.cursorLine && cursor {
+		fill = cursorLineBg
+	}
+
+	rows := min(len(starts), max(maxRows, 1))
+	for r, from := range starts[:rows] {
+		if r > 0 {
+			m.writeGutter(s, -1, cursor)
+		}
+		end := min(len(cells), from+m.textWidth())
+		if r+1 < len(starts) {
+			end = starts[r+1]
+		}
+
+		current := cellStyle(0)
+		for c := from; c < end; c++ {
+			if style := styles[source[c]]; style != current {
+				s.WriteString(styleReset)
+				s.WriteString(style.sequence())
+				current = style
+			}
+			switch {
+			case cells[c] == wideTail:
+				// Only shown when the left half is scrolled off
+				if c == from {
+					s.WriteRune(' ')
+				}
+			case c+1 < len(cells) && cells[c+1] == wideTail && c+1 >= from+m.textWidth():
+				s.WriteRune(' ') // The right half would be cut off
+			default:
+				s.WriteRune(cells[c])
+			}
+		}
+		if current != 0 {
+			s.WriteString(styleReset)
+		}
+
+		used := max(0, end-from)
+		atEnd := cursor && r == len(starts)-1 && m.cursorX >= len(line)
+		if atEnd && block {
+			s.WriteString(cursorStart + " " + styleReset)
+			used++
+		}
+		s.WriteString(fill)
+		if atEnd && !block {
+			s.WriteRune('|')
+			used++
+		}
+		if fill != "" {
+			s.WriteString(strings.Repeat(" ", max(0, m.textWidth()-used)))
+			s.WriteString(styleReset)
+			used = m.textWidth()
+		}
+		endRow(used)
+	}
+	return rows
+}
+
 func main() {
-	filename := ""
-	if len(os.Args) > 1 {
-		filename = os.Args[1]
+	tabSize := flag.Int("tabsize", 0, "show tabs `n` columns wide")
+	readOnly := flag.Bool("readonly", false, "refuse changes to the buffers")
+	line := flag.Int("line", 0, "start with the cursor on line `n`")
+	keymap := flag.String("keymap", "", "key bindings, `vim` or emacs")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [filename...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *tabSize < 0 || *line < 0 || *keymap != "" && !slices.Contains(keymaps, *keymap) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// With text piped in for "-", keys come from the terminal instead
+	input := os.Stdin
+	if slices.Contains(flag.Args(), stdinFilename) {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			fmt.Println("Failed to open the terminal:", err)
+			os.Exit(1)
+		}
+		defer tty.Close()
+		input = tty
 	}
 
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	oldState, err := term.MakeRaw(int(input.Fd()))
 	if err != nil {
 		fmt.Println("Failed to set terminal to raw mode:", err)
 		return
 	}
-	defer term.Restore(int(os.Stdin.Fd()), oldState)
+	defer term.Restore(int(input.Fd()), oldState)
 
-	p := tea.NewProgram(initialModel(filename), tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	m := initialModel(flag.Args()...)
+	m.loadConfig(configPath())
+	// Flags take precedence over the settings file
+	if *tabSize > 0 {
+		m.tabSize = *tabSize
+	}
+	if *readOnly {
+		m.readOnly = true
+	}
+	if *line > 0 {
+		m.goToLine(*line)
+	}
+	if *keymap != "" {
+		m.keymap = *keymap
+	}
+	m.applyKeymap()
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion(), tea.WithInput(input))
+	final, err := p.Run()
+	if err != nil {
 		fmt.Printf("Error running program: %v", err)
 		os.Exit(1)
 	}
+	// A clean exit leaves nothing to recover
+	if m, ok := final.(model); ok {
+		m.buffers[m.bufferIndex] = m.buffer
+		for i := range m.buffers {
+			m.buffers[i].removeSwap()
+		}
+	}
 }
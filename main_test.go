@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// newTestModel returns an editor holding text on an 80x24 screen.
+func newTestModel(text string) model {
+	m := initialModel()
+	m.content, m.finalNewline = splitLines([]byte(text))
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	return updated.(model)
+}
+
+// testKeys are the keys tests name that aren't typed as text.
+var testKeys = map[string]tea.KeyType{
+	"esc":       tea.KeyEsc,
+	"enter":     tea.KeyEnter,
+	"backspace": tea.KeyBackspace,
+	"ctrl+r":    tea.KeyCtrlR,
+	"ctrl+a":    tea.KeyCtrlA,
+}
+
+// press types keys into m one after the other.
+func press(m model, keys ...string) model {
+	for _, key := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		if t, ok := testKeys[key]; ok {
+			msg = tea.KeyMsg{Type: t}
+		}
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	return m
+}
+
+func TestWordMotionsOverPunctuation(t *testing.T) {
+	m := newTestModel("foo.bar(baz)\nqux")
+	for _, want := range [][2]int{{0, 3}, {0, 4}, {0, 7}, {0, 8}, {0, 11}, {1, 0}} {
+		m = press(m, "w")
+		if got := [2]int{m.cursorY, m.cursorX}; got != want {
+			t.Fatalf("w: cursor at %v, want %v", got, want)
+		}
+	}
+	for _, want := range [][2]int{{0, 11}, {0, 8}, {0, 7}, {0, 4}, {0, 3}, {0, 0}, {0, 0}} {
+		m = press(m, "b")
+		if got := [2]int{m.cursorY, m.cursorX}; got != want {
+			t.Fatalf("b: cursor at %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEndOfWordSkipsBlankLines(t *testing.T) {
+	m := newTestModel("foo bar   \n    \nbaz")
+	for _, want := range [][2]int{{0, 2}, {0, 6}, {2, 2}, {2, 2}} {
+		m = press(m, "e")
+		if got := [2]int{m.cursorY, m.cursorX}; got != want {
+			t.Fatalf("e: cursor at %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSearchFromEmptyLineAndLineEnd(t *testing.T) {
+	m := newTestModel("\nfoo\nbar foo")
+	m = press(m, "/", "f", "o", "o", "enter")
+	if got := [2]int{m.cursorY, m.cursorX}; got != [2]int{1, 0} {
+		t.Fatalf("/foo from an empty line: cursor at %v, want [1 0]", got)
+	}
+	m = press(m, "j", "$", "n")
+	if got := [2]int{m.cursorY, m.cursorX}; got != [2]int{1, 0} {
+		t.Errorf("n from the end of a line: cursor at %v, want [1 0]", got)
+	}
+	m = press(m, "g", "g", "N")
+	if got := [2]int{m.cursorY, m.cursorX}; got != [2]int{2, 4} {
+		t.Errorf("N from an empty line: cursor at %v, want [2 4]", got)
+	}
+}
+
+func TestDeleteWordAcrossPunctuation(t *testing.T) {
+	m := newTestModel("foo, bar\nbaz")
+	for _, want := range []struct{ line, clipboard string }{
+		{", bar", "foo"},
+		{"bar", ", "},
+		{"", "bar"},
+	} {
+		m = press(m, "d", "w")
+		if got := string(m.content[0]); got != want.line || m.clipboard != want.clipboard {
+			t.Fatalf("dw: line %q with %q yanked, want %q with %q yanked", got, m.clipboard, want.line, want.clipboard)
+		}
+	}
+	if len(m.content) != 2 {
+		t.Errorf("dw at the end of a line joined the next line: %d lines", len(m.content))
+	}
+	m = press(m, "u")
+	if got := string(m.content[0]); got != "bar" {
+		t.Errorf("u after dw: line %q, want %q", got, "bar")
+	}
+}
+
+func TestViewOutput(t *testing.T) {
+	m := newTestModel("package main\n\nfunc main() {}")
+	m.filename = "main.go"
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 30, Height: 6})
+	m = updated.(model)
+	m.syntax, m.cursorLine = false, false
+	want := "1 " + styleReset + cursorStart + "p" + styleReset + "ackage main\n" +
+		"2 \n" +
+		"3 func main() {}\n" +
+		"~\n" +
+		"NORMAL {Normal mode} main.go              (1,1) 3 lines All "
+	if got := m.View(); got != want {
+		t.Errorf("View() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+// BenchmarkView renders a 10,000-line Go file while scrolling through it.
+func BenchmarkView(b *testing.B) {
+	var text strings.Builder
+	for i := range 10000 {
+		fmt.Fprintf(&text, "\tx%d := fmt.Sprintf(\"%%d\", %d) // Line %d\n", i, i, i)
+	}
+	m := newTestModel(text.String())
+	m.filename = "bench.go"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		m.cursorY = i * 20 % len(m.content)
+		m.adjustOffset()
+		_ = m.View()
+	}
+}
+
+func TestModeString(t *testing.T) {
+	tests := []struct {
+		mode mode
+		want string
+	}{
+		{normalMode, "NORMAL"},
+		{insertMode, "INSERT"},
+		{searchMode, "SEARCH"},
+		{replaceMode, "REPLACE"},
+		{commandMode, "COMMAND"},
+		{promptMode, "PROMPT"},
+		{confirmMode, "CONFIRM"},
+		{visualMode, "VISUAL"},
+		{matchesMode, "MATCHES"},
+		{finderMode, "FIND"},
+		{mode(99), "mode(99)"},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.String(); got != tt.want {
+			t.Errorf("mode %d: String() = %q, want %q", int(tt.mode), got, tt.want)
+		}
+	}
+}
+
+func TestPasteAtEndAndIntoEmptyBuffer(t *testing.T) {
+	tests := []struct {
+		name, text string
+		keys       []string
+		want       string
+	}{
+		{"p on the last line", "a\nb", []string{"j", "y", "y", "p"}, "a\nb\nb"},
+		{"P on the last line", "a\nb", []string{"j", "y", "y", "P"}, "a\nb\nb"},
+		{"3p on the last line", "a\nb", []string{"j", "y", "y", "3", "p"}, "a\nb\nb\nb\nb"},
+		{"line into an empty buffer", "", []string{"y", "y", "p"}, "\n"},
+		{"word on the last line", "ab\ncd", []string{"j", "d", "w", "p"}, "ab\ncd"},
+	}
+	for _, tt := range tests {
+		m := press(newTestModel(tt.text), tt.keys...)
+		if got := m.text(); got != tt.want {
+			t.Errorf("%s: buffer %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	m := newTestModel("")
+	m.content = nil // A buffer without even an empty line
+	m.yankText("x\n", true)
+	m = press(m, "p")
+	if got := m.text(); got != "x" {
+		t.Errorf("line into a buffer without lines: %q, want %q", got, "x")
+	}
+	m = newTestModel("")
+	m.yankText("word", false)
+	m = press(m, "p")
+	if got := m.text(); got != "word" {
+		t.Errorf("text into an empty buffer: %q, want %q", got, "word")
+	}
+}
+
+func TestAddToNumberPastLineEnd(t *testing.T) {
+	m := newTestModel("x 41")
+	m.cursorX = 10
+	m = press(m, "ctrl+a")
+	if got := string(m.content[0]); got != "x 41" || m.statusMsg != "No number on this line" {
+		t.Errorf("Ctrl+A past the end: line %q, status %q", got, m.statusMsg)
+	}
+	m = press(m, "0", "ctrl+a")
+	if got := string(m.content[0]); got != "x 42" {
+		t.Errorf("Ctrl+A: line %q, want %q", got, "x 42")
+	}
+}
+
+func TestLastLineMovesToFirstNonBlank(t *testing.T) {
+	m := press(newTestModel("package main\n  ab"), "$", "G")
+	if got := [2]int{m.cursorY, m.cursorX}; got != [2]int{1, 2} {
+		t.Fatalf("$ G: cursor at %v, want [1 2]", got)
+	}
+	m = press(m, "i", "x")
+	if got := string(m.content[1]); got != "  xab" {
+		t.Errorf("$ G i x: line %q, want %q", got, "  xab")
+	}
+}
+
+func TestMacroRecordsRepeatOnce(t *testing.T) {
+	m := press(newTestModel("abcdef"), "x", "q", "a", ".", "q")
+	if got := string(m.content[0]); got != "cdef" {
+		t.Fatalf("x q a . q: line %q, want %q", got, "cdef")
+	}
+	m = press(m, "@", "a")
+	if got := string(m.content[0]); got != "def" {
+		t.Errorf("@a after recording .: line %q, want %q", got, "def")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "unicode"
+
+// setMark remembers the cursor position under the letter r.
+func (m *model) setMark(r rune) {
+	if !unicode.IsLetter(r) {
+		m.statusMsg = "Invalid mark: " + string(r)
+		return
+	}
+	m.marks[r] = [2]int{m.cursorY, m.cursorX}
+	m.statusMsg = "Mark " + string(r) + " set"
+}
+
+// jumpToMark moves the cursor to the position remembered under r. A mark
+// whose line no longer exists is dropped.
+func (m *model) jumpToMark(r rune) {
+	pos, ok := m.marks[r]
+	if ok && pos[0] >= len(m.content) {
+		delete(m.marks, r)
+		ok = false
+	}
+	if !ok {
+		m.statusMsg = "Mark not set"
+		return
+	}
+	m.pushJump()
+	m.cursorY = pos[0]
+	m.cursorX = min(pos[1], len(m.content[m.cursorY]))
+	m.adjustOffset()
+}
+
+// shiftLineRefs keeps marks and folds on their lines after n lines were
+// inserted at y, or after -n lines were removed from y onwards.
+func (m *model) shiftLineRefs(y, n int) {
+	m.shiftMarks(y, n)
+	m.shiftFolds(y, n)
+}
+
+// shiftMarks keeps marks on their lines after n lines were inserted at y, or
+// after -n lines were removed from y onwards, in which case marks on the
+// removed lines are dropped.
+func (m *model) shiftMarks(y, n int) {
+	for r, pos := range m.marks {
+		switch {
+		case pos[0] < y:
+		case n < 0 && pos[0] < y-n:
+			delete(m.marks, r)
+		default:
+			m.marks[r] = [2]int{pos[0] + n, pos[1]}
+		}
+	}
+}
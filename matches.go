@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// listMatches collects every match of the search term for :matches and shows
+// them in a list to pick one from, starting at the first match after the
+// cursor.
+func (m *model) listMatches() {
+	re, ok := m.searchPattern()
+	if !ok {
+		return
+	}
+	m.matches = m.matches[:0]
+	m.matchIndex = -1
+	for y, line := range m.content {
+		for _, match := range searchMatches(line, re) {
+			if m.matchIndex < 0 && (y > m.cursorY || y == m.cursorY && match[0] >= m.cursorX) {
+				m.matchIndex = len(m.matches)
+			}
+			m.matches = append(m.matches, [2]int{y, match[0]})
+		}
+	}
+	if len(m.matches) == 0 {
+		m.statusMsg = "Pattern not found: " + m.searchTerm
+		return
+	}
+	if m.matchIndex < 0 {
+		m.matchIndex = 0
+	}
+	m.mode = matchesMode
+	m.showMatchCount()
+}
+
+// showMatchCount reports the selected match and the number of matches.
+func (m *model) showMatchCount() {
+	m.statusMsg = "Match " + strconv.Itoa(m.matchIndex+1) + " of " + strconv.Itoa(len(m.matches)) + " for /" + m.searchTerm
+}
+
+// handleMatchesMode moves through the match list, jumping to the selected
+// match on Enter.
+func (m model) handleMatchesMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		m.matchIndex = max(m.matchIndex-1, 0)
+	case "down", "j":
+		m.matchIndex = min(m.matchIndex+1, len(m.matches)-1)
+	case "pgup", "ctrl+b":
+		m.matchIndex = max(m.matchIndex-m.rows, 0)
+	case "pgdown", "ctrl+f":
+		m.matchIndex = min(m.matchIndex+m.rows, len(m.matches)-1)
+	case "home", "g":
+		m.matchIndex = 0
+	case "end", "G":
+		m.matchIndex = len(m.matches) - 1
+	case "enter":
+		m.mode = normalMode
+		m.pushJump()
+		match := m.matches[m.matchIndex]
+		// The buffer may have been edited since the list was made
+		m.cursorY = min(match[0], len(m.content)-1)
+		m.cursorX = min(match[1], len(m.content[m.cursorY]))
+		m.adjustOffset()
+		m.showMatchCount()
+		return m, nil
+	case "esc", "q":
+		m.mode = normalMode
+		m.statusMsg = ""
+		return m, nil
+	}
+	m.showMatchCount()
+	return m, nil
+}
+
+// renderMatches writes the match list over the whole text area, one match
+// per row with its line, column and the text of its line.
+func (m model) renderMatches(s *strings.Builder) {
+	m.renderList(s, len(m.matches), m.matchIndex, func(i int) string {
+		y := m.matches[i][0]
+		var line []rune
+		if y < len(m.content) {
+			line = m.content[y]
+		}
+		return fmt.Sprintf("%4d:%-4d", y+1, m.matches[i][1]+1) + strings.TrimLeft(string(line), " \t")
+	})
+}
+
+// renderList writes a list of n items over the whole text area, one per row
+// cut to the width of the screen, with the selected item highlighted and
+// kept in the middle of the screen where it can be.
+func (m model) renderList(s *strings.Builder, n, selected int, item func(i int) string) {
+	top := max(min(selected-m.rows/2, n-m.rows), 0)
+	for row := 0; row < m.rows; row++ {
+		i := top + row
+		if i >= n {
+			s.WriteString("~\n")
+			continue
+		}
+		cells, _ := expandTabs([]rune(item(i)), m.tabSize)
+		if i == selected {
+			s.WriteString(selectStart)
+		}
+		used := 0
+		for _, r := range cells {
+			if used >= m.width || r != wideTail && runeWidth(r) > 1 && used+1 >= m.width {
+				break
+			}
+			if r != wideTail {
+				s.WriteRune(r)
+			}
+			used++
+		}
+		if i == selected {
+			s.WriteString(strings.Repeat(" ", max(m.width-used, 0)))
+			s.WriteString(styleReset)
+		}
+		s.WriteByte('\n')
+	}
+}
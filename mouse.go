@@ -0,0 +1,112 @@
+package main
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// scrollLines is how many lines a turn of the mouse wheel scrolls.
+const scrollLines = 3
+
+// handleMouse moves the cursor to a clicked position, selects the text a
+// drag passes over and scrolls for the mouse wheel. Only the focused pane
+// reacts, and only in modes where the cursor is free to move.
+func (m model) handleMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	if m.mode != normalMode && m.mode != insertMode && m.mode != visualMode {
+		return m, nil
+	}
+	switch {
+	case msg.Button == tea.MouseButtonWheelUp:
+		m.scroll(-scrollLines)
+	case msg.Button == tea.MouseButtonWheelDown:
+		m.scroll(scrollLines)
+	case msg.Button == tea.MouseButtonLeft && msg.Action == tea.MouseActionPress:
+		if y, x, ok := m.positionAt(msg.X, msg.Y); ok {
+			if m.mode == visualMode {
+				m.mode = normalMode // A click drops the selection
+				m.statusMsg = "Normal mode"
+			}
+			m.cursorY, m.cursorX = y, x
+			m.adjustOffset()
+		}
+	case msg.Button == tea.MouseButtonLeft && msg.Action == tea.MouseActionMotion:
+		m.drag(msg.X, msg.Y)
+	}
+	return m, nil
+}
+
+// drag extends the selection to the cursor position at screen cell x, y,
+// starting one at the clicked position first. Dragging past the top or
+// bottom of the pane scrolls it by a line.
+func (m *model) drag(x, y int) {
+	if m.mode == normalMode {
+		m.enterVisualMode(false)
+	} else if m.mode != visualMode {
+		return
+	}
+	top := m.paneTop()
+	if y < top {
+		m.scroll(-1)
+		y = top
+	} else if y >= top+m.height {
+		m.scroll(1)
+		y = top + m.height - 1
+	}
+	if lineNum, col, ok := m.positionAt(x, y); ok {
+		m.cursorY, m.cursorX = lineNum, col
+		m.adjustOffset()
+	}
+}
+
+// positionAt returns the line and column shown at screen cell x, y of the
+// focused pane. A click on the gutter picks the start of the row, and one
+// below the last line picks the last row.
+func (m model) positionAt(x, y int) (int, int, bool) {
+	row := y - m.paneTop()
+	if row < 0 || row >= m.height {
+		return 0, 0, false
+	}
+	lineNum, starts := m.offsetY, m.rowStarts(m.offsetY)
+	for row >= len(starts) {
+		next := m.nextVisibleLine(lineNum)
+		if next >= len(m.content) {
+			row = len(starts) - 1
+			break
+		}
+		row -= len(starts)
+		lineNum, starts = next, m.rowStarts(next)
+	}
+	col := max(x-m.gutter(), 0)
+	if x >= m.gutter() && !m.wrap {
+		col += m.offsetX
+	}
+	return lineNum, m.runeInRow(m.content[lineNum], starts, row, col), true
+}
+
+// paneTop returns the screen row the focused pane starts on.
+func (m model) paneTop() int {
+	if m.split && !m.splitBelow {
+		return m.rows - m.height
+	}
+	return 0
+}
+
+// scroll moves the view n visible lines down, or -n up, taking the cursor
+// along when it would leave the screen.
+func (m *model) scroll(n int) {
+	for ; n > 0; n-- {
+		next := m.nextVisibleLine(m.offsetY)
+		if next >= len(m.content) {
+			break
+		}
+		m.offsetY = next
+	}
+	for ; n < 0 && m.offsetY > 0; n++ {
+		m.offsetY = m.prevVisibleLine(m.offsetY)
+	}
+
+	if m.cursorY < m.offsetY {
+		m.cursorY = m.offsetY
+	} else if last := m.lineAfterRows(m.offsetY, m.height); m.cursorY >= last {
+		m.cursorY = max(m.prevVisibleLine(min(last, len(m.content))), m.offsetY)
+	}
+	m.cursorX = min(m.cursorX, len(m.content[m.cursorY]))
+	m.adjustOffset()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// option is a setting changed with ":set". A boolean option has flag set,
+// a number option number and a string option text.
+type option struct {
+	name    string
+	short   string // Abbreviation, "" when there is none
+	flag    func(m *model) *bool
+	number  func(m *model) *int
+	text    func(m *model) *string
+	min     int                    // Smallest value of a number option
+	values  []string               // Values a string option may take, any when nil
+	changed func(m *model) tea.Cmd // Run after the value changed, if not nil
+}
+
+// options are the settings ":set" knows about.
+var options = []option{
+	{name: "autoindent", short: "ai", flag: func(m *model) *bool { return &m.autoIndent }},
+	{name: "autopairs", flag: func(m *model) *bool { return &m.autoPairs }},
+	{name: "autosave", number: func(m *model) *int { return &m.autosave }, changed: (*model).restartAutosave},
+	{name: "backup", flag: func(m *model) *bool { return &m.backup }},
+	{name: "cursorline", short: "cul", flag: func(m *model) *bool { return &m.cursorLine }},
+	{name: "expandtab", short: "et", flag: func(m *model) *bool { return &m.expandTab }},
+	{name: "gofmt", flag: func(m *model) *bool { return &m.gofmt }},
+	{name: "hlsearch", short: "hls", flag: func(m *model) *bool { return &m.hlsearch }},
+	{name: "ignorecase", short: "ic", flag: func(m *model) *bool { return &m.searchIgnoreCase }},
+	{name: "keymap", text: func(m *model) *string { return &m.keymap }, values: keymaps, changed: (*model).applyKeymap},
+	{name: "list", flag: func(m *model) *bool { return &m.list }},
+	{name: "number", short: "nu", flag: func(m *model) *bool { return &m.number }, changed: adjustView},
+	{name: "readonly", short: "ro", flag: func(m *model) *bool { return &m.readOnly }},
+	{name: "regex", flag: func(m *model) *bool { return &m.searchRegex }},
+	{name: "relativenumber", short: "rnu", flag: func(m *model) *bool { return &m.relativeNumbers }, changed: adjustView},
+	{name: "scrollbar", flag: func(m *model) *bool { return &m.scrollbar }, changed: adjustView},
+	{name: "statusline", short: "stl", text: func(m *model) *string { return &m.statusFormat }},
+	{name: "syntax", flag: func(m *model) *bool { return &m.syntax }},
+	{name: "tabsize", short: "ts", number: func(m *model) *int { return &m.tabSize }, min: 1, changed: adjustView},
+	{name: "undolevels", short: "ul", number: func(m *model) *int { return &m.undoLevels }, min: 1},
+	{name: "wrap", flag: func(m *model) *bool { return &m.wrap }, changed: adjustView},
+	{name: "wrapscan", short: "ws", flag: func(m *model) *bool { return &m.searchWrap }},
+}
+
+// adjustView keeps the cursor on screen after an option changed the layout.
+func adjustView(m *model) tea.Cmd {
+	m.adjustOffset()
+	return nil
+}
+
+// lookupOption returns the option called name, by its full name or its
+// abbreviation.
+func lookupOption(name string) (option, bool) {
+	for _, o := range options {
+		if name == o.name || name != "" && name == o.short {
+			return o, true
+		}
+	}
+	return option{}, false
+}
+
+// setOption applies the argument of a ":set" command: "name=value" sets an
+// option, "name" and "noname" switch a boolean one on and off, and "name?"
+// shows the value. "name" alone also shows the value of other options. A
+// number option that may be 0 is turned off with "noname".
+func (m *model) setOption(arg string) tea.Cmd {
+	if arg == "" {
+		m.statusMsg = "Argument required"
+		return nil
+	}
+	name, value, assign := strings.Cut(arg, "=")
+	name, query := strings.CutSuffix(name, "?")
+	o, ok := lookupOption(name)
+	off := false
+	if !ok && !assign && !query {
+		if rest, found := strings.CutPrefix(name, "no"); found {
+			o, ok = lookupOption(rest)
+			off = ok
+		}
+	}
+	if !ok {
+		m.statusMsg = "Unknown option: " + name
+		return nil
+	}
+	if query || !assign && !off && o.flag == nil {
+		m.statusMsg = o.show(m)
+		return nil
+	}
+
+	switch {
+	case o.flag != nil:
+		if assign {
+			m.statusMsg = "Invalid argument: " + arg
+			return nil
+		}
+		*o.flag(m) = !off
+	case o.number != nil:
+		n, err := strconv.Atoi(value)
+		if off && o.min == 0 {
+			n, err = 0, nil
+		}
+		if err != nil || n < o.min {
+			m.statusMsg = fmt.Sprintf("Invalid %s: %s", o.name, value)
+			return nil
+		}
+		*o.number(m) = n
+	case o.text != nil:
+		if off {
+			m.statusMsg = "Invalid argument: " + arg
+			return nil
+		}
+		if o.values != nil && !slices.Contains(o.values, value) {
+			m.statusMsg = fmt.Sprintf("Invalid %s: %s", o.name, value)
+			return nil
+		}
+		*o.text(m) = value
+	}
+	if o.changed != nil {
+		return o.changed(m)
+	}
+	return nil
+}
+
+// show describes the value of the option like ":set name?" reports it.
+func (o option) show(m *model) string {
+	switch {
+	case o.flag != nil && *o.flag(m):
+		return o.name
+	case o.flag != nil:
+		return "no" + o.name
+	case o.number != nil:
+		return o.name + "=" + strconv.Itoa(*o.number(m))
+	default:
+		return o.name + "=" + *o.text(m)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "slices"
+
+// pairs maps the brackets and quotes autopairs closes to their closers.
+var pairs = map[rune]rune{'(': ')', '[': ']', '{': '}', '"': '"', '\'': '\''}
+
+// typePair types r with autopairs set, reporting whether it did. An opener
+// gets its closer after the cursor, and a closer already right after the
+// cursor is typed over. Nothing is closed before a word, nor a quote after
+// one, where it is more likely an apostrophe.
+func (m *model) typePair(r rune) bool {
+	line := m.content[m.cursorY]
+	x := m.cursorX
+	if x < len(line) && line[x] == r && (r == ')' || r == ']' || r == '}' || pairs[r] == r) {
+		m.cursorX++
+		return true
+	}
+	closer, ok := pairs[r]
+	if !ok || x < len(line) && isWordChar(line[x]) || closer == r && x > 0 && isWordChar(line[x-1]) {
+		return false
+	}
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = slices.Insert(line, x, r, closer)
+	m.cursorX++
+	m.modified = true
+	return true
+}
+
+// deletePair removes an opener before the cursor together with the closer
+// right after it for Backspace, reporting whether there was such a pair.
+func (m *model) deletePair() bool {
+	line := m.content[m.cursorY]
+	x := m.cursorX
+	if x == 0 || x >= len(line) || pairs[line[x-1]] != line[x] {
+		return false
+	}
+	m.changeLines(m.cursorY, m.cursorY+1)
+	m.content[m.cursorY] = slices.Delete(line, x-1, x+1)
+	m.cursorX--
+	m.modified = true
+	return true
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// Commands tried in order to reach the system clipboard.
+var (
+	clipboardCopyCommands = [][]string{
+		{"pbcopy"},
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	}
+	clipboardPasteCommands = [][]string{
+		{"pbpaste"},
+		{"wl-paste", "--no-newline"},
+		{"xclip", "-selection", "clipboard", "-o"},
+		{"xsel", "--clipboard", "--output"},
+	}
+)
+
+var errNoClipboard = errors.New("no clipboard tool found (pbcopy, wl-copy, xclip or xsel)")
+
+// selectRegister picks the register the next yank, delete or paste uses, as
+// typed after '"'. '"' itself names the unnamed register.
+func (m *model) selectRegister(r rune) {
+	switch {
+	case r == '"':
+		m.register = 0
+	case r == '+' || r == '*':
+		m.register = '+' // Both name the system clipboard
+	case unicode.IsLetter(r) || unicode.IsDigit(r):
+		m.register = unicode.ToLower(r)
+	default:
+		m.statusMsg = fmt.Sprintf("Invalid register name: %c", r)
+	}
+}
+
+// yankText stores yanked or deleted text in the selected register,
+// remembering whether it is made of whole lines. As in vim, the unnamed
+// register always receives a copy.
+func (m *model) yankText(text string, linewise bool) {
+	if m.register == '+' {
+		if err := writeSystemClipboard(text); err != nil {
+			m.statusMsg = "Clipboard unavailable: " + err.Error()
+		}
+		m.register = 0
+	} else if m.register != 0 {
+		m.registers[m.register] = text
+		m.linewiseRegisters[m.register] = linewise
+		m.register = 0
+	}
+	m.clipboard = text
+	m.clipboardLinewise = linewise
+}
+
+// registerText returns the contents of the selected register for pasting,
+// and whether they are whole lines. Text from the system clipboard is taken
+// as whole lines when it ends in a line break.
+func (m *model) registerText() (string, bool) {
+	r := m.register
+	m.register = 0
+	if r == 0 {
+		return m.clipboard, m.clipboardLinewise
+	}
+	if r == '+' {
+		text, err := readSystemClipboard()
+		if err != nil {
+			m.statusMsg = "Clipboard unavailable: " + err.Error()
+		}
+		return text, strings.HasSuffix(text, "\n")
+	}
+	if m.registers[r] == "" {
+		m.statusMsg = fmt.Sprintf("Nothing in register %c", r)
+	}
+	return m.registers[r], m.linewiseRegisters[r]
+}
+
+// clipboardCommand returns the first of commands that is installed.
+func clipboardCommand(commands [][]string) (*exec.Cmd, error) {
+	for _, args := range commands {
+		if _, err := exec.LookPath(args[0]); err == nil {
+			return exec.Command(args[0], args[1:]...), nil
+		}
+	}
+	return nil, errNoClipboard
+}
+
+func writeSystemClipboard(text string) error {
+	cmd, err := clipboardCommand(clipboardCopyCommands)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+func readSystemClipboard() (string, error) {
+	cmd, err := clipboardCommand(clipboardPasteCommands)
+	if err != nil {
+		return "", err
+	}
+	out, err := cmd.Output()
+	return string(out), err
+}
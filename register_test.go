@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestRegisterOnlyLastsOneYank(t *testing.T) {
+	saved := clipboardCopyCommands
+	clipboardCopyCommands = nil // Leave the real clipboard alone
+	t.Cleanup(func() { clipboardCopyCommands = saved })
+
+	for _, r := range []string{"a", "+"} {
+		m := press(newTestModel("one\ntwo"), "\"", r, "y", "y")
+		if m.register != 0 {
+			t.Errorf("\"%syy: register %q still selected after the yank", r, m.register)
+		}
+	}
+}
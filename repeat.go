@@ -0,0 +1,55 @@
+package main
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// recordChange handles a key, collecting the keys typed in normal and insert
+// mode so the command they make up can be repeated.
+func (m model) recordChange(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.mode != normalMode && m.mode != insertMode {
+		m.changeKeys = nil
+		return m.handleKey(msg)
+	}
+	if len(m.changeKeys) == 0 {
+		m.changeStart = m.changeTick
+	}
+	m.changeKeys = append(m.changeKeys, msg)
+	next, cmd := m.handleKey(msg)
+	nm := next.(model)
+	nm.endChange()
+	return nm, cmd
+}
+
+// endChange keeps the collected keys for . once they make up a complete
+// command that changed the buffer.
+func (m *model) endChange() {
+	switch {
+	case m.mode == insertMode, m.pendingOp != "", m.count != 0:
+		return // The command is still in progress
+	case m.mode == normalMode && m.changeTick != m.changeStart:
+		m.lastChange = m.changeKeys
+	}
+	m.changeKeys = nil
+}
+
+// repeatChange replays the keys of the last change as a single undo action.
+func (m model) repeatChange() (tea.Model, tea.Cmd) {
+	m.count = 0
+	if len(m.lastChange) == 0 {
+		return m, nil
+	}
+	keys := m.lastChange
+
+	// Only the . is recorded into a macro, not the keys it replays
+	recording := m.recording
+	m.recording = 0
+	var cmds []tea.Cmd
+	m.repeat(1, func() {
+		for _, msg := range keys {
+			next, cmd := m.Update(msg)
+			m = next.(model)
+			cmds = append(cmds, cmd)
+		}
+	})
+	m.recording = recording
+	return m, tea.Batch(cmds...)
+}
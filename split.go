@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// splitWindow shows buffer i in a new pane above the current one and gives
+// it focus.
+func (m *model) splitWindow(i int) {
+	if i == m.bufferIndex {
+		m.statusMsg = "Buffer is already shown"
+		return
+	}
+	m.closeSplit()
+	previous := m.bufferIndex
+	m.switchBuffer(i)
+	m.split = true
+	m.splitBuffer = previous
+	m.splitBelow = true
+	m.layout()
+}
+
+// closeSplit leaves only the focused pane on screen.
+func (m *model) closeSplit() {
+	m.split = false
+	m.layout()
+}
+
+// layout divides the screen rows between the panes, keeping one row for the
+// separator when split.
+func (m *model) layout() {
+	m.height = m.rows
+	if m.split {
+		top := (m.rows - 1) / 2
+		if m.splitBelow {
+			m.height = top
+		} else {
+			m.height = m.rows - 1 - top
+		}
+	}
+	m.adjustOffset()
+}
+
+// separator returns the line between the panes, naming the buffer above it.
+func (m model) separator(filename string) string {
+	label := "── " + bufferName(filename) + " "
+	return label + strings.Repeat("─", max(0, m.width-utf8.RuneCountInString(label)))
+}
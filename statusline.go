@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultStatusFormat lays out the status bar when :set statusline isn't
+// used.
+const defaultStatusFormat = "%M {%s} %-20f (%l,%c) %L lines %p %m%r"
+
+// statusLine fills in the placeholders of the statusFormat setting:
+//
+//	%M  mode            %f  filename
+//	%s  status message  %m  [+] when modified
+//	%l  line            %r  [RO] when read-only
+//	%c  column          %L  number of lines
+//	%p  scroll position (Top, Bot, All or a percentage)
+//	%%  a literal %
+//
+// A width between the % and the letter pads the field with spaces, on the
+// right when it starts with a minus sign like "%-20f". The mode is followed by
+// the macro being recorded, if any.
+func (m model) statusLine() string {
+	format := m.statusFormat
+	var s strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			s.WriteByte(format[i])
+			continue
+		}
+		j := i + 1
+		left := j < len(format) && format[j] == '-'
+		if left {
+			j++
+		}
+		width := 0
+		for ; j < len(format) && '0' <= format[j] && format[j] <= '9'; j++ {
+			width = width*10 + int(format[j]-'0')
+		}
+		if j == len(format) {
+			s.WriteString(format[i:]) // Nothing to fill in
+			break
+		}
+
+		var field string
+		switch format[j] {
+		case 'M':
+			field = m.mode.String()
+			if m.recording != 0 {
+				field += " recording @" + string(m.recording)
+			}
+		case 's':
+			field = m.statusMsg
+		case 'f':
+			field = m.filename
+		case 'l':
+			field = strconv.Itoa(m.cursorY + 1)
+		case 'c':
+			field = strconv.Itoa(m.cursorX + 1)
+		case 'L':
+			field = strconv.Itoa(len(m.content))
+		case 'p':
+			field = m.scrollPosition()
+		case 'm':
+			if m.modified {
+				field = "[+]"
+			}
+		case 'r':
+			if m.readOnly {
+				field = "[RO]"
+			}
+		case '%':
+			field = "%"
+		default:
+			field = format[i : j+1] // Not a placeholder, keep it as typed
+		}
+
+		padding := strings.Repeat(" ", max(0, width-utf8.RuneCountInString(field)))
+		if left {
+			s.WriteString(field + padding)
+		} else {
+			s.WriteString(padding + field)
+		}
+		i = j
+	}
+	return s.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// swapPath returns the hidden swap file kept next to filename.
+func swapPath(filename string) string {
+	dir, base := filepath.Split(filename)
+	return filepath.Join(dir, "."+base+".swp")
+}
+
+// updateSwap copies unsaved changes into the swap file, and removes it once
+// the buffer matches the file again. Unnamed buffers have no swap file.
+func (m *model) updateSwap() {
+	if m.filename == "" {
+		return
+	}
+	if !m.modified {
+		m.removeSwap()
+		return
+	}
+	if err := os.WriteFile(swapPath(m.filename), []byte(m.text()), 0600); err != nil {
+		m.statusMsg = "Error writing swap file: " + err.Error()
+		return
+	}
+	m.swapWritten = true
+}
+
+// removeSwap deletes the swap file written by this session, leaving any
+// found at startup alone until the user decides about it.
+func (m *buffer) removeSwap() {
+	if m.swapWritten {
+		os.Remove(swapPath(m.filename))
+		m.swapWritten = false
+	}
+}
+
+// offerRecovery asks whether to restore the buffer from a swap file left
+// behind by a session that did not exit cleanly.
+func (m *model) offerRecovery() {
+	if m.filename == "" {
+		return
+	}
+	path := swapPath(m.filename)
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	m.prompt("Swap file "+path+" found. Recover it? (y/n): ", func(m *model, input string) tea.Cmd {
+		if input != "y" && input != "Y" {
+			os.Remove(path)
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			m.statusMsg = "Error reading swap file: " + err.Error()
+			return nil
+		}
+		m.content, m.finalNewline = splitLines(data)
+		m.modified = true
+		m.statusMsg = "Recovered from " + path
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import "unicode"
+
+// syntaxSpan styles the runes [start, end) of a line.
+type syntaxSpan struct {
+	start, end int
+	style      cellStyle
+}
+
+// highlighters tokenize a single line for the files with a given extension.
+var highlighters = map[string]func(line []rune) []syntaxSpan{
+	".go": highlightGo,
+}
+
+var goKeywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+}
+
+// highlightLine returns the syntax spans of line for a file with extension
+// ext, or nil if no highlighter handles it.
+func highlightLine(line []rune, ext string) []syntaxSpan {
+	if highlight, ok := highlighters[ext]; ok {
+		return highlight(line)
+	}
+	return nil
+}
+
+// highlightGo finds keywords, literals and line comments. Each line is
+// tokenized on its own, so block comments and raw strings spanning several
+// lines are not recognized past their first line.
+func highlightGo(line []rune) []syntaxSpan {
+	var spans []syntaxSpan
+	for i := 0; i < len(line); {
+		start := i
+		switch r := line[i]; {
+		case r == '/' && i+1 < len(line) && line[i+1] == '/':
+			return append(spans, syntaxSpan{start, len(line), styleComment})
+		case r == '"' || r == '\'' || r == '`':
+			i = quotedEnd(line, i)
+			spans = append(spans, syntaxSpan{start, i, styleString})
+		case unicode.IsDigit(r):
+			for i < len(line) && (isWordChar(line[i]) || line[i] == '.') {
+				i++
+			}
+			spans = append(spans, syntaxSpan{start, i, styleNumber})
+		case isWordChar(r):
+			for i < len(line) && isWordChar(line[i]) {
+				i++
+			}
+			if goKeywords[string(line[start:i])] {
+				spans = append(spans, syntaxSpan{start, i, styleKeyword})
+			}
+		default:
+			i++
+		}
+	}
+	return spans
+}
+
+// quotedEnd returns the index just past the literal opened by the quote at
+// start, or len(line) if it is not closed on this line. Backslash escapes
+// apply to all but raw strings.
+func quotedEnd(line []rune, start int) int {
+	quote := line[start]
+	for i := start + 1; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && quote != '`':
+			i++
+		case line[i] == quote:
+			return i + 1
+		}
+	}
+	return len(line)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// textSpan is the text a text object covers, from line startY, column
+// startX up to line endY, column endX exclusive. A linewise span covers the
+// whole lines from startY to endY.
+type textSpan struct {
+	startY, startX, endY, endX int
+	linewise                   bool
+}
+
+// textObject returns the span of the text object typed after i or a in an
+// operator like diw or ca(: inner leaves out the brackets or quotes around
+// it, or for a word the blanks after it.
+func (m model) textObject(key string, inner bool) (textSpan, bool) {
+	switch key {
+	case "w":
+		return m.wordObject(inner)
+	case "(", ")", "b":
+		return m.bracketObject('(', inner)
+	case "[", "]":
+		return m.bracketObject('[', inner)
+	case "{", "}", "B":
+		return m.bracketObject('{', inner)
+	case "\"", "'", "`":
+		return m.quoteObject([]rune(key)[0], inner)
+	}
+	return textSpan{}, false
+}
+
+// wordObject returns the word under the cursor, or the run of blanks or
+// punctuation it is on. Around a word the blanks after it are included, or
+// those before it at the end of the line.
+func (m model) wordObject(inner bool) (textSpan, bool) {
+	line := m.content[m.cursorY]
+	if len(line) == 0 {
+		return textSpan{}, false
+	}
+	x := min(m.cursorX, len(line)-1)
+	class := charClass(line[x])
+	start, end := x, x+1
+	for start > 0 && charClass(line[start-1]) == class {
+		start--
+	}
+	for end < len(line) && charClass(line[end]) == class {
+		end++
+	}
+	if !inner && class != blankClass {
+		switch {
+		case end < len(line) && charClass(line[end]) == blankClass:
+			for end < len(line) && charClass(line[end]) == blankClass {
+				end++
+			}
+		default:
+			for start > 0 && charClass(line[start-1]) == blankClass {
+				start--
+			}
+		}
+	}
+	return textSpan{startY: m.cursorY, startX: start, endY: m.cursorY, endX: end}, true
+}
+
+// bracketObject returns the text inside the innermost pair of open and its
+// closing bracket around the cursor. When the brackets end and start their
+// lines, the inner text is the whole lines between them.
+func (m model) bracketObject(open rune, inner bool) (textSpan, bool) {
+	y, x, ok := m.enclosingBracket(open)
+	if !ok {
+		return textSpan{}, false
+	}
+	endY, endX, ok := matchBracket(m.content, y, x)
+	if !ok {
+		return textSpan{}, false
+	}
+	if !inner {
+		return textSpan{startY: y, startX: x, endY: endY, endX: endX + 1}, true
+	}
+	if endY > y+1 && x+1 == len(m.content[y]) && firstNonBlank(m.content[endY]) == endX {
+		return textSpan{startY: y + 1, endY: endY - 1, linewise: true}, true
+	}
+	return textSpan{startY: y, startX: x + 1, endY: endY, endX: endX}, true
+}
+
+// enclosingBracket returns the position of the open bracket of the innermost
+// pair around the cursor, or under it.
+func (m model) enclosingBracket(open rune) (int, int, bool) {
+	closer := bracketPairs[open]
+	y, x := m.cursorY, min(m.cursorX, len(m.content[m.cursorY])-1)
+	if x >= 0 && m.content[y][x] == closer {
+		x-- // On the closer, the pair it closes is the one
+	}
+	depth := 0
+	for {
+		for ; x >= 0; x-- {
+			switch m.content[y][x] {
+			case closer:
+				depth++
+			case open:
+				if depth == 0 {
+					return y, x, true
+				}
+				depth--
+			}
+		}
+		if y == 0 {
+			return 0, 0, false
+		}
+		y--
+		x = len(m.content[y]) - 1
+	}
+}
+
+// quoteObject returns the quoted text on the cursor line the cursor is in,
+// or failing that the next one after it. Quotes pair up from the start of
+// the line.
+func (m model) quoteObject(quote rune, inner bool) (textSpan, bool) {
+	line := m.content[m.cursorY]
+	var quotes []int
+	for i, r := range line {
+		if r == quote && (i == 0 || line[i-1] != '\\') {
+			quotes = append(quotes, i)
+		}
+	}
+	for i := 0; i+1 < len(quotes); i += 2 {
+		start, end := quotes[i], quotes[i+1]
+		if m.cursorX <= end {
+			if inner {
+				start, end = start+1, end-1
+			}
+			return textSpan{startY: m.cursorY, startX: start, endY: m.cursorY, endX: end + 1}, true
+		}
+	}
+	return textSpan{}, false
+}
+
+// operateOnObject deletes the text object typed after the di, da, ci or ca
+// in op, keeping it in the clipboard, and starts inserting for a change. It
+// does nothing when the cursor is not in such an object.
+func (m *model) operateOnObject(op, key string) {
+	span, ok := m.textObject(key, op[1] == 'i')
+	if !ok {
+		return
+	}
+	change := op[0] == 'c'
+	if change {
+		m.enterInsertMode() // Snapshot first so the deletion undoes with the insert
+	} else {
+		m.saveAction() // Save current state for undo
+	}
+	if span.linewise {
+		m.deleteLineSpan(span, change)
+	} else {
+		m.deleteSpan(span)
+	}
+}
+
+// deleteSpan removes the text of span, keeping it in the clipboard, and
+// leaves the cursor where it started.
+func (m *model) deleteSpan(span textSpan) {
+	m.cursorY, m.cursorX = span.startY, span.startX
+	if span.startY == span.endY && span.startX == span.endX {
+		return // An empty pair like ()
+	}
+	var lines []string
+	for y := span.startY; y <= span.endY; y++ {
+		line := m.content[y]
+		from, to := 0, len(line)
+		if y == span.startY {
+			from = span.startX
+		}
+		if y == span.endY {
+			to = span.endX
+		}
+		lines = append(lines, string(line[from:to]))
+	}
+	m.yankText(strings.Join(lines, "\n"), false)
+
+	m.changeLines(span.startY, span.endY+1)
+	joined := append([]rune{}, m.content[span.startY][:span.startX]...)
+	joined = append(joined, m.content[span.endY][span.endX:]...)
+	m.content = append(m.content[:span.startY+1], m.content[span.endY+1:]...)
+	m.content[span.startY] = joined
+	m.shiftLineRefs(span.startY+1, span.startY-span.endY)
+	m.modified = true
+	m.adjustOffset()
+}
+
+// deleteLineSpan removes the lines of a linewise span, keeping them in the
+// clipboard. A change leaves a line to type on in their place, indented like
+// the first of them when auto-indent is on.
+func (m *model) deleteLineSpan(span textSpan, change bool) {
+	var text strings.Builder
+	for _, line := range m.content[span.startY : span.endY+1] {
+		text.WriteString(string(line) + "\n")
+	}
+	m.yankText(text.String(), true)
+
+	var kept [][]rune
+	if change {
+		var indent []rune
+		if m.autoIndent {
+			first := m.content[span.startY]
+			indent = slices.Clone(first[:firstNonBlank(first)])
+		}
+		kept = [][]rune{indent}
+	}
+	m.changeLines(span.startY, span.endY+1)
+	m.content = slices.Replace(m.content, span.startY, span.endY+1, kept...)
+	m.shiftLineRefs(span.startY+len(kept), len(kept)-(span.endY+1-span.startY))
+	m.cursorY = min(span.startY, len(m.content)-1)
+	m.cursorX = len(m.content[m.cursorY])
+	if !change {
+		m.cursorX = firstNonBlank(m.content[m.cursorY])
+	}
+	m.modified = true
+	m.adjustOffset()
+}
@@ -0,0 +1,178 @@
+package main
+
+import "slices"
+
+// action is an undo entry: the lines an edit replaced, starting at line
+// start, and the cursor to restore when it is undone or redone.
+type action struct {
+	start   int
+	old     [][]rune // Lines before the edit
+	new     [][]rune // Lines after the edit
+	cursorX int
+	cursorY int
+}
+
+// snapshot is what the edit in progress has changed so far: copies of the
+// lines it replaced, which started at line start and were followed by the
+// last tail lines of the buffer. Edits only ever change the lines between
+// start and the tail, so the rest of the buffer never needs copying.
+type snapshot struct {
+	touched bool     // Whether changeLines has been called since beginUndo
+	start   int      // First line changed
+	old     [][]rune // Copies of the changed lines as they were
+	tail    int      // Lines after the changed ones, left as they were
+	cursorX int
+	cursorY int
+}
+
+func (m *model) saveAction() {
+	m.beginUndo()
+	m.redoStack = nil // Clear redo stack when a new action is performed
+	m.changeTick++
+}
+
+// beginUndo starts a new edit, first turning the previous one into an undo
+// entry. While repeat holds the undo history, the edits after the first one
+// all belong to the same entry.
+func (m *model) beginUndo() {
+	if m.undoHeld && m.undoBase != nil {
+		return
+	}
+	m.flushUndo()
+	m.undoBase = &snapshot{
+		cursorX: m.cursorX,
+		cursorY: m.cursorY,
+	}
+}
+
+// changeLines is called by every edit before it changes lines start to end
+// of the buffer, or inserts lines between them. The edit in progress keeps a
+// copy of the ones it hasn't changed yet, so undo costs as much as the lines
+// an edit touches rather than the whole buffer. Changes made outside an edit
+// are not recorded.
+func (m *model) changeLines(start, end int) {
+	base := m.undoBase
+	switch {
+	case base == nil:
+		return
+	case !base.touched:
+		base.touched = true
+		base.start = start
+		base.old = deepCopyContent(m.content[start:end])
+		base.tail = len(m.content) - end
+		return
+	}
+	if start < base.start {
+		base.old = append(deepCopyContent(m.content[start:base.start]), base.old...)
+		base.start = start
+	}
+	if changedEnd := len(m.content) - base.tail; end > changedEnd {
+		base.old = append(base.old, deepCopyContent(m.content[changedEnd:end])...)
+		base.tail = len(m.content) - end
+	}
+}
+
+// changedLines returns the lines the edit in progress has put in place of
+// its old ones.
+func (m model) changedLines() [][]rune {
+	return m.content[m.undoBase.start : len(m.content)-m.undoBase.tail]
+}
+
+// editChanged reports whether the edit in progress has left the buffer
+// different from how it found it.
+func (m model) editChanged() bool {
+	return m.undoBase != nil && m.undoBase.touched && !equalContent(m.undoBase.old, m.changedLines())
+}
+
+// flushUndo pushes the lines changed by the edit in progress onto the undo
+// stack, dropping the oldest entries beyond undoLevels.
+func (m *model) flushUndo() {
+	base := m.undoBase
+	if base == nil || !base.touched {
+		m.undoBase = nil
+		return
+	}
+	changed := m.changedLines()
+	m.undoBase = nil
+	start, oldEnd, newEnd := diffLines(base.old, changed)
+	if start == oldEnd && start == newEnd {
+		return // Nothing changed
+	}
+	m.undoStack = append(m.undoStack, action{
+		start:   base.start + start,
+		old:     slices.Clone(base.old[start:oldEnd]), // Let go of the rest of the copies
+		new:     deepCopyContent(changed[start:newEnd]),
+		cursorX: base.cursorX,
+		cursorY: base.cursorY,
+	})
+	if n := len(m.undoStack) - m.undoLevels; n > 0 {
+		clear(m.undoStack[:n]) // Let the dropped entries be collected
+		m.undoStack = m.undoStack[n:]
+	}
+}
+
+// diffLines returns the range of lines that differ between a and b: lines
+// start to oldEnd of a were replaced by lines start to newEnd of b.
+func diffLines(a, b [][]rune) (start, oldEnd, newEnd int) {
+	for start < len(a) && start < len(b) && slices.Equal(a[start], b[start]) {
+		start++
+	}
+	oldEnd, newEnd = len(a), len(b)
+	for oldEnd > start && newEnd > start && slices.Equal(a[oldEnd-1], b[newEnd-1]) {
+		oldEnd--
+		newEnd--
+	}
+	return start, oldEnd, newEnd
+}
+
+// applyDiff redoes a, replacing its old lines with its new ones.
+func (m *model) applyDiff(a action) {
+	m.content = slices.Replace(m.content, a.start, a.start+len(a.old), deepCopyContent(a.new)...)
+}
+
+// revertDiff undoes a, putting its old lines back.
+func (m *model) revertDiff(a action) {
+	m.content = slices.Replace(m.content, a.start, a.start+len(a.new), deepCopyContent(a.old)...)
+}
+
+func (m *model) undo() {
+	m.flushUndo()
+	if len(m.undoStack) > 0 {
+		// Pop the last action from undo stack
+		lastAction := m.undoStack[len(m.undoStack)-1]
+		m.undoStack = m.undoStack[:len(m.undoStack)-1]
+
+		// Revert it, and save the current cursor for redo
+		m.revertDiff(lastAction)
+		lastAction.cursorX, m.cursorX = m.cursorX, lastAction.cursorX
+		lastAction.cursorY, m.cursorY = m.cursorY, lastAction.cursorY
+		m.redoStack = append(m.redoStack, lastAction)
+		m.folds = nil // The restored lines may not match them
+
+		m.modified = true
+		m.statusMsg = "Undo performed"
+	} else {
+		m.statusMsg = "Nothing to undo"
+	}
+}
+
+func (m *model) redo() {
+	m.flushUndo()
+	if len(m.redoStack) > 0 {
+		// Pop the last action from redo stack
+		lastAction := m.redoStack[len(m.redoStack)-1]
+		m.redoStack = m.redoStack[:len(m.redoStack)-1]
+
+		// Apply it again, and save the current cursor for undo
+		m.applyDiff(lastAction)
+		lastAction.cursorX, m.cursorX = m.cursorX, lastAction.cursorX
+		lastAction.cursorY, m.cursorY = m.cursorY, lastAction.cursorY
+		m.undoStack = append(m.undoStack, lastAction)
+		m.folds = nil // The restored lines may not match them
+
+		m.modified = true
+		m.statusMsg = "Redo performed"
+	} else {
+		m.statusMsg = "Nothing to redo"
+	}
+}
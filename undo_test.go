@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUndoLevelsCap(t *testing.T) {
+	m := newTestModel("abcdefg")
+	m = press(m, strings.Split(":set undolevels=3", "")...)
+	m = press(m, "enter", "x", "x", "x", "x", "x")
+	if len(m.undoStack) != 3 {
+		t.Fatalf("%d undo entries, want 3", len(m.undoStack))
+	}
+	m = press(m, "u", "u", "u")
+	if got := string(m.content[0]); got != "cdefg" {
+		t.Errorf("after undoing everything kept: %q, want %q", got, "cdefg")
+	}
+	m = press(m, "u")
+	if m.statusMsg != "Nothing to undo" {
+		t.Errorf("undo past the cap: %q, want %q", m.statusMsg, "Nothing to undo")
+	}
+}
+
+func TestEditCopiesOnlyTouchedLines(t *testing.T) {
+	m := newTestModel(strings.Repeat("line\n", 10000))
+	m = press(m, "5", "0", "j", "x", "o", "n", "e", "w", "esc")
+	if base := m.undoBase; base == nil || len(base.old) != 0 || base.start != 51 {
+		t.Fatalf("o kept %+v, want no old lines from line 51", base)
+	}
+	m = press(m, "k", "d", "d")
+	if n := len(m.undoStack[len(m.undoStack)-1].old); n != 0 {
+		t.Errorf("o recorded %d old lines, want 0", n)
+	}
+	if base := m.undoBase; len(base.old) != 1 || base.start != 50 {
+		t.Errorf("dd kept %d old lines from line %d, want 1 from line 50", len(base.old), base.start)
+	}
+	m = press(m, "u", "u", "u")
+	if got := m.text(); got != strings.Repeat("line\n", 10000) {
+		t.Errorf("undoing everything left %d lines", len(m.content))
+	}
+}
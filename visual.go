@@ -0,0 +1,196 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func (m model) handleVisualMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.pendingOp == "g" {
+		m.pendingOp = ""
+		if msg.String() == "c" {
+			if m.readOnly {
+				m.refuseEdit()
+				return m, nil
+			}
+			startY, _, endY, _ := m.selectionBounds()
+			m.toggleComment(startY, endY)
+			m.mode = normalMode
+			return m, nil
+		}
+		if msg.String() == "g" {
+			m.applyMotion("gg")
+			return m, nil
+		}
+		if msg.String() == "ctrl+g" {
+			m.showSelectionCount()
+			return m, nil
+		}
+	} else if msg.String() == "g" {
+		m.pendingOp = "g" // Starts gg, gc or g Ctrl+G
+		return m, nil
+	}
+	if m.applyMotion(msg.String()) {
+		return m, nil
+	}
+
+	if m.readOnly && visualEditKeys[msg.String()] {
+		m.refuseEdit()
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "esc":
+		m.mode = normalMode
+		m.statusMsg = "Normal mode"
+	case "v", "V":
+		// The key of the current kind of selection ends it, the other one
+		// switches to that kind.
+		linewise := msg.String() == "V"
+		if m.selLinewise == linewise {
+			m.mode = normalMode
+			m.statusMsg = "Normal mode"
+		} else {
+			m.selLinewise = linewise
+			m.statusMsg = visualStatus(linewise)
+		}
+	case "y":
+		m.statusMsg = "Selection yanked to clipboard"
+		m.yankText(m.selectedText(), m.selLinewise)
+		m.mode = normalMode
+		m.cursorY, m.cursorX, _, _ = m.selectionBounds()
+	case ":":
+		startY, _, endY, _ := m.selectionBounds()
+		m.visualLines = [2]int{startY, endY}
+		m.mode = commandMode
+		m.commandBuffer = "'<,'>"
+		m.statusMsg = ":" + m.commandBuffer
+	case ">", "<":
+		startY, _, endY, _ := m.selectionBounds()
+		m.shiftLines(startY, endY, msg.String() == ">")
+		m.mode = normalMode
+		m.statusMsg = "Normal mode"
+	case "d", "x":
+		m.statusMsg = "Selection deleted"
+		m.yankText(m.selectedText(), m.selLinewise)
+		if m.selLinewise {
+			m.deleteSelectedLines()
+		} else {
+			m.deleteSelection()
+		}
+		m.mode = normalMode
+	}
+	return m, nil
+}
+
+// visualEditKeys are the visual mode keys that change the selected text.
+var visualEditKeys = map[string]bool{"d": true, "x": true, ">": true, "<": true}
+
+// enterVisualMode anchors a selection at the cursor. A linewise selection
+// always covers whole lines.
+func (m *model) enterVisualMode(linewise bool) {
+	m.mode = visualMode
+	m.selLinewise = linewise
+	m.selStartX = m.cursorX
+	m.selStartY = m.cursorY
+	m.statusMsg = visualStatus(linewise)
+}
+
+func visualStatus(linewise bool) string {
+	if linewise {
+		return "-- VISUAL LINE --"
+	}
+	return "-- VISUAL --"
+}
+
+// selectionBounds returns the selection between the anchor and the cursor in
+// document order. The end column is exclusive, so the rune under the cursor
+// is part of the selection like in vim.
+func (m model) selectionBounds() (startY, startX, endY, endX int) {
+	startY, startX = m.selStartY, m.selStartX
+	endY, endX = m.cursorY, m.cursorX
+	if endY < startY || endY == startY && endX < startX {
+		startY, startX, endY, endX = endY, endX, startY, startX
+	}
+	if m.selLinewise {
+		return startY, 0, endY, len(m.content[endY])
+	}
+	startX = min(startX, len(m.content[startY]))
+	endX = min(endX+1, len(m.content[endY]))
+	return startY, startX, endY, endX
+}
+
+// selectedRange returns the [start, end) runes selected on line y, if any.
+func (m model) selectedRange(y int) (start, end int, ok bool) {
+	startY, startX, endY, endX := m.selectionBounds()
+	if y < startY || y > endY {
+		return 0, 0, false
+	}
+	start, end = 0, len(m.content[y])
+	if y == startY {
+		start = startX
+	}
+	if y == endY {
+		end = endX
+	}
+	return start, end, true
+}
+
+// selectedText returns the selection with its lines joined by newlines. A
+// linewise selection ends in a newline so it pastes back as whole lines.
+func (m model) selectedText() string {
+	startY, startX, endY, endX := m.selectionBounds()
+	if m.selLinewise {
+		var s strings.Builder
+		for y := startY; y <= endY; y++ {
+			s.WriteString(string(m.content[y]) + "\n")
+		}
+		return s.String()
+	}
+	if startY == endY {
+		return string(m.content[startY][startX:endX])
+	}
+
+	lines := []string{string(m.content[startY][startX:])}
+	for y := startY + 1; y < endY; y++ {
+		lines = append(lines, string(m.content[y]))
+	}
+	lines = append(lines, string(m.content[endY][:endX]))
+	return strings.Join(lines, "\n")
+}
+
+// deleteSelection removes the selection, joining the text before and after
+// it into a single line.
+func (m *model) deleteSelection() {
+	startY, startX, endY, endX := m.selectionBounds()
+	m.saveAction() // Save current state for undo
+	m.changeLines(startY, endY+1)
+
+	joined := append([]rune{}, m.content[startY][:startX]...)
+	joined = append(joined, m.content[endY][endX:]...)
+	m.content = append(m.content[:startY+1], m.content[endY+1:]...)
+	m.content[startY] = joined
+	m.shiftLineRefs(startY+1, startY-endY)
+
+	m.cursorY, m.cursorX = startY, startX
+	m.modified = true
+	m.adjustOffset()
+}
+
+// deleteSelectedLines removes every line touched by the selection.
+func (m *model) deleteSelectedLines() {
+	startY, _, endY, _ := m.selectionBounds()
+	m.saveAction() // Save current state for undo
+	m.changeLines(startY, endY+1)
+
+	m.content = append(m.content[:startY], m.content[endY+1:]...)
+	m.shiftLineRefs(startY, startY-endY-1)
+	if len(m.content) == 0 {
+		m.content = [][]rune{{}}
+	}
+	m.cursorY = min(startY, len(m.content)-1)
+	m.cursorX = firstNonBlank(m.content[m.cursorY])
+	m.modified = true
+	m.adjustOffset()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// countWords returns the number of words, separated by blanks, and of
+// characters in lines. Line breaks are not counted as characters.
+func countWords(lines [][]rune) (words, chars int) {
+	for _, line := range lines {
+		words += len(strings.Fields(string(line)))
+		chars += len(line)
+	}
+	return words, chars
+}
+
+// showWordCount shows the number of lines, words and characters in lines
+// startY to endY for :wc, or in the whole buffer when they cover it.
+func (m *model) showWordCount(startY, endY int) {
+	words, chars := countWords(m.content[startY : endY+1])
+	if endY-startY+1 == len(m.content) {
+		m.statusMsg = fmt.Sprintf("%d lines; %d words; %d characters", len(m.content), words, chars)
+		return
+	}
+	allWords, allChars := countWords(m.content)
+	m.statusMsg = fmt.Sprintf("Selected %d of %d lines; %d of %d words; %d of %d characters",
+		endY-startY+1, len(m.content), words, allWords, chars, allChars)
+}
+
+// showSelectionCount shows the number of lines, words and characters in the
+// visual selection for g Ctrl+G.
+func (m *model) showSelectionCount() {
+	startY, _, endY, _ := m.selectionBounds()
+	var selected [][]rune
+	for y := startY; y <= endY; y++ {
+		start, end, _ := m.selectedRange(y)
+		selected = append(selected, m.content[y][start:end])
+	}
+	words, chars := countWords(selected)
+	allWords, allChars := countWords(m.content)
+	m.statusMsg = fmt.Sprintf("Selected %d of %d lines; %d of %d words; %d of %d characters",
+		len(selected), len(m.content), words, allWords, chars, allChars)
+}
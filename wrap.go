@@ -0,0 +1,93 @@
+package main
+
+// wrapRows returns the cell each screen row of a line starts at when it is
+// wrapped to width columns. Rows break after the last space that fits, or
+// where the row is full when a word is longer than the row. A double-width
+// rune is never split across rows.
+func wrapRows(cells []rune, width int) []int {
+	starts := []int{0}
+	for start := 0; len(cells)-start > width; {
+		end := start + width
+		brk := end
+		for brk > start && cells[brk-1] != ' ' {
+			brk--
+		}
+		if brk == start {
+			brk = end
+			if cells[brk] == wideTail {
+				brk-- // Move the whole rune to the next row
+			}
+			if brk == start {
+				brk = end + 1 // A row narrower than the rune still takes it
+			}
+		}
+		starts = append(starts, brk)
+		start = brk
+	}
+	return starts
+}
+
+// rowStarts returns the cells the screen rows of line y start at. A line
+// takes a single row unless wrap is set, and so does a fold.
+func (m model) rowStarts(y int) []int {
+	if !m.wrap || m.foldAt(y) >= 0 {
+		return []int{0}
+	}
+	cells, _ := expandTabs(m.content[y], m.tabSize)
+	return wrapRows(cells, m.textWidth())
+}
+
+// rowAt returns the index of the row holding cell col.
+func rowAt(starts []int, col int) int {
+	r := len(starts) - 1
+	for r > 0 && starts[r] > col {
+		r--
+	}
+	return r
+}
+
+// runeInRow returns the rune shown col columns into row r of line, or the
+// last one of the row when it is shorter. Only the last row reaches past the
+// end of the line.
+func (m model) runeInRow(line []rune, starts []int, r, col int) int {
+	col += starts[r]
+	if r+1 < len(starts) && col >= starts[r+1] {
+		col = starts[r+1] - 1
+	}
+	return runeAtColumn(line, col, m.tabSize)
+}
+
+// moveRows moves the cursor dy screen rows down, or -dy up, through wrapped
+// lines, keeping its column within the row where the row is long enough.
+func (m *model) moveRows(dy int) {
+	line := m.content[m.cursorY]
+	starts := m.rowStarts(m.cursorY)
+	col := displayColumn(line, m.cursorX, m.tabSize)
+	r := rowAt(starts, col)
+	col -= starts[r]
+	for ; dy > 0; dy-- {
+		if r+1 < len(starts) {
+			r++
+			continue
+		}
+		next := m.nextVisibleLine(m.cursorY)
+		if next >= len(m.content) {
+			break
+		}
+		m.cursorY, starts, r = next, m.rowStarts(next), 0
+	}
+	for ; dy < 0; dy++ {
+		if r > 0 {
+			r--
+			continue
+		}
+		if m.cursorY == 0 {
+			break
+		}
+		m.cursorY = m.prevVisibleLine(m.cursorY)
+		starts = m.rowStarts(m.cursorY)
+		r = len(starts) - 1
+	}
+	m.cursorX = m.runeInRow(m.content[m.cursorY], starts, r, col)
+	m.adjustOffset()
+}